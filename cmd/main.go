@@ -28,5 +28,26 @@ func loadEnv() {
 
 func main() {
 	loadEnv()
+
+	if len(os.Args) > 1 {
+		var run func([]string) error
+		switch os.Args[1] {
+		case "rebuild":
+			run = service.Rebuild
+		case "migrate":
+			run = service.Migrate
+		case "dead-letters":
+			run = service.DeadLetters
+		}
+
+		if run != nil {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	service.Run()
 }
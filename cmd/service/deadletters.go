@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/grpc/pb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DeadLetters asks the admin listener of a running service to list
+// or replay events its projections gave up on. Replay takes IDs of
+// the articles whose events are replayed, all of them if there are none.
+//
+//	dead-letters [-addr host:port] [-projection name] list
+//	dead-letters [-addr host:port] [-projection name] replay [article-id...]
+func DeadLetters(args []string) error {
+	flags := flag.NewFlagSet("dead-letters", flag.ContinueOnError)
+	addr := flags.String("addr", DefaultAdminAddr, "Address of the admin listener of the running service")
+	projection := flags.String("projection", "", "Projection whose dead letters are used, all of them if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	command := flags.Arg(0)
+	if command != "list" && command != "replay" {
+		return errors.New("expected one of: list, replay")
+	}
+	if command == "list" && flags.NArg() != 1 {
+		return errors.New("list takes no arguments")
+	}
+
+	var projections []string
+	if *projection != "" {
+		projections = []string{*projection}
+	}
+
+	conn, err := grpc.Dial(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := pb.NewAdminServiceClient(conn)
+	ctx := context.Background()
+
+	if command == "replay" {
+		resp, err := client.ReplayDeadLetters(ctx, &pb.ReplayDeadLettersRequest{
+			Projections:  projections,
+			AggregateIds: flags.Args()[1:],
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "replayed %d dead letters\n", resp.GetReplayed())
+		return nil
+	}
+
+	resp, err := client.ListDeadLetters(ctx, &pb.ListDeadLettersRequest{
+		Projections: projections,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, letter := range resp.GetDeadLetters() {
+		fmt.Fprintf(os.Stdout, "%s: position %d, %s %s version %d, %d attempts, failed at %s: %s\n",
+			letter.GetProjection(), letter.GetPosition(), letter.GetType(), letter.GetAggregateId(), letter.GetVersion(),
+			letter.GetAttempts(), letter.GetFailedAt().AsTime().Format(time.RFC3339), letter.GetError(),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Migrate applies, reverts or lists migrations of the databases
+// of the storage. The storage is read from the environment
+// the same way the service reads it.
+//
+//	migrate [-storage sqlite|postgres] [-database write|read] up
+//	migrate [-storage sqlite|postgres] [-database write|read] [-steps n] down
+//	migrate [-storage sqlite|postgres] [-database write|read] status
+func Migrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.StringVar(&storageKind, "storage", storageSQLite, "Storage whose databases are migrated")
+	only := flags.String("database", "", `Migrate only the "write" or the "read" database`)
+	steps := flags.Int("steps", 1, "Number of migrations reverted by down")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	command := flags.Arg(0)
+	if flags.NArg() != 1 || (command != "up" && command != "down" && command != "status") {
+		return errors.New("expected one of: up, down, status")
+	}
+
+	ctx := context.Background()
+
+	dbs, err := openDatabases(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeDatabases(dbs)
+
+	if *only != "" {
+		dbs, err = selectDatabase(dbs, *only)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch command {
+	case "up":
+		for _, db := range dbs {
+			applied, err := db.migrator.Up(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to migrate the %s database: %w", db.name, err)
+			}
+			for _, migration := range applied {
+				fmt.Fprintf(os.Stdout, "%s: applied %04d_%s\n", db.name, migration.Version, migration.Name)
+			}
+		}
+	case "down":
+		if *steps < 1 {
+			return errors.New("-steps must be positive")
+		}
+		// Revert the read database first, it is rebuilt from the write one.
+		for i := len(dbs) - 1; i >= 0; i-- {
+			reverted, err := dbs[i].migrator.Down(ctx, *steps)
+			if err != nil {
+				return fmt.Errorf("failed to revert the %s database: %w", dbs[i].name, err)
+			}
+			for _, migration := range reverted {
+				fmt.Fprintf(os.Stdout, "%s: reverted %04d_%s\n", dbs[i].name, migration.Version, migration.Name)
+			}
+		}
+	case "status":
+		for _, db := range dbs {
+			statuses, err := db.migrator.Status(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to read migrations of the %s database: %w", db.name, err)
+			}
+			for _, status := range statuses {
+				state := "pending"
+				if status.Applied {
+					state = "applied " + status.AppliedAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(os.Stdout, "%s: %04d_%s %s\n", db.name, status.Version, status.Name, state)
+			}
+		}
+	}
+
+	return nil
+}
+
+func selectDatabase(dbs []database, name string) ([]database, error) {
+	for _, db := range dbs {
+		if db.name == name {
+			return []database{db}, nil
+		}
+	}
+	return nil, fmt.Errorf("storage %q has no %q database", storageKind, name)
+}
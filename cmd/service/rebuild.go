@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/krixlion/dev-forum_article/pkg/grpc/pb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Rebuild asks the admin listener of a running service to rebuild
+// projections and prints the progress. Names of the projections are given as arguments,
+// all of them are rebuilt if there are none.
+//
+//	rebuild [-addr host:port] [projection...]
+func Rebuild(args []string) error {
+	flags := flag.NewFlagSet("rebuild", flag.ContinueOnError)
+	addr := flags.String("addr", DefaultAdminAddr, "Address of the admin listener of the running service")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	conn, err := grpc.Dial(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := pb.NewAdminServiceClient(conn)
+	stream, err := client.RebuildProjections(context.Background(), &pb.RebuildProjectionsRequest{
+		Projections: flags.Args(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		progress, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if progress.GetDone() {
+			fmt.Fprintf(os.Stdout, "%s: rebuilt up to position %d\n", progress.GetProjection(), progress.GetPosition())
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "%s: %d/%d\n", progress.GetProjection(), progress.GetPosition(), progress.GetHead())
+	}
+}
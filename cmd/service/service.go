@@ -5,34 +5,182 @@ import (
 	"flag"
 	"fmt"
 	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/krixlion/dev-forum_article/pkg/broker"
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
 	"github.com/krixlion/dev-forum_article/pkg/grpc/pb"
 	"github.com/krixlion/dev-forum_article/pkg/grpc/server"
+	"github.com/krixlion/dev-forum_article/pkg/idgen"
 	"github.com/krixlion/dev-forum_article/pkg/log"
+	"github.com/krixlion/dev-forum_article/pkg/postgres"
+	"github.com/krixlion/dev-forum_article/pkg/query"
+	"github.com/krixlion/dev-forum_article/pkg/validation"
 
+	"github.com/nats-io/nats.go"
 	"google.golang.org/grpc"
 )
 
 var (
-	port int
+	port               int
+	adminAddr          string
+	retention          time.Duration
+	purgeInterval      time.Duration
+	importMode         bool
+	idempotencyTTL     time.Duration
+	rules              = validation.DefaultRules()
+	storageKind        string
+	dataDir            string
+	snapshotPolicy     = cmd.DefaultSnapshotPolicy()
+	natsURL            string
+	consistencyTimeout time.Duration
+	autoMigrate        bool
+	writePool          = pool{maxConns: postgres.DefaultMaxOpenConns, connLifetime: postgres.DefaultConnMaxLifetime, statementTimeout: postgres.DefaultStatementTimeout}
+	readPool           = writePool
 )
 
 func init() {
-	portFlag := flag.Int("port", 50051, "The server port")
-	flag.Parse()
-	port = *portFlag
+	flag.IntVar(&port, "port", 50051, "The server port")
+	flag.StringVar(&adminAddr, "admin-addr", DefaultAdminAddr, "Address of the listener serving maintenance RPCs, which have no authentication, disabled if empty")
+	flag.DurationVar(&retention, "tombstone-retention", server.DefaultTombstoneRetention, "How long deleted articles can be restored")
+	flag.DurationVar(&purgeInterval, "purge-interval", time.Hour, "How often expired tombstones are purged")
+	flag.BoolVar(&importMode, "import-mode", false, "Keep article IDs supplied by clients")
+	flag.IntVar(&rules.MinTitleLength, "title-min-length", rules.MinTitleLength, "Minimum number of characters in a title")
+	flag.IntVar(&rules.MaxTitleLength, "title-max-length", rules.MaxTitleLength, "Maximum number of characters in a title, 0 for no limit")
+	flag.IntVar(&rules.MaxBodyBytes, "body-max-bytes", rules.MaxBodyBytes, "Maximum size of a body in bytes, 0 for no limit")
+	flag.DurationVar(&idempotencyTTL, "idempotency-ttl", server.DefaultIdempotencyTTL, "How long every replica keeps responses for retries with the same idempotency key")
+	flag.StringVar(&storageKind, "storage", storageMemory, `Where articles are kept: "memory", "file" in -data-dir, "sqlite" in DB_WRITE_DBNAME and DB_READ_DBNAME or "postgres" in databases described by DB_WRITE_* and DB_READ_*`)
+	flag.StringVar(&dataDir, "data-dir", "", "Directory of the file storage")
+	flag.BoolVar(&autoMigrate, "auto-migrate", true, "Apply pending migrations of the storage on start")
+	flag.IntVar(&writePool.maxConns, "db-write-max-conns", writePool.maxConns, "Maximum number of connections to the write database")
+	flag.DurationVar(&writePool.connLifetime, "db-write-conn-lifetime", writePool.connLifetime, "How long connections to the write database are reused")
+	flag.DurationVar(&writePool.statementTimeout, "db-write-statement-timeout", writePool.statementTimeout, "How long statements on the write database may run, 0 for no limit")
+	flag.IntVar(&readPool.maxConns, "db-read-max-conns", readPool.maxConns, "Maximum number of connections to the read database")
+	flag.DurationVar(&readPool.connLifetime, "db-read-conn-lifetime", readPool.connLifetime, "How long connections to the read database are reused")
+	flag.DurationVar(&readPool.statementTimeout, "db-read-statement-timeout", readPool.statementTimeout, "How long statements on the read database may run, 0 for no limit")
+	flag.IntVar(&snapshotPolicy.Every, "snapshot-every", snapshotPolicy.Every, "Number of events replayed on top of a snapshot after which a new one is taken, 0 for no limit")
+	flag.DurationVar(&consistencyTimeout, "consistency-timeout", server.DefaultConsistencyTimeout, "How long reads wait for the read model to reflect a consistency token")
+	flag.StringVar(&natsURL, "nats-url", "", "URL of the NATS server events are published to, events stay in process if empty")
+	flag.IntVar(&snapshotPolicy.MaxBytes, "snapshot-bytes", snapshotPolicy.MaxBytes, "Size of events replayed on top of a snapshot after which a new one is taken, 0 for no limit")
+}
+
+// shutdownTimeout bounds how long requests in flight are waited for
+// after a termination signal.
+const shutdownTimeout = 10 * time.Second
+
+// DefaultAdminAddr only accepts connections from the host
+// the service runs on.
+const DefaultAdminAddr = "127.0.0.1:50052"
+
+// aggregateType reads the type of the aggregate from AGGREGATE_ID.
+func aggregateType() string {
+	if aggregateId := os.Getenv("AGGREGATE_ID"); aggregateId != "" {
+		return aggregateId
+	}
+	return cmd.DefaultAggregateType
+}
+
+// DefaultProjectName is used when PROJECT_NAME is not set.
+const DefaultProjectName = "dev-forum"
+
+// projectName reads the name of the project topics belong to from PROJECT_NAME.
+func projectName() string {
+	if name := os.Getenv("PROJECT_NAME"); name != "" {
+		return name
+	}
+	return DefaultProjectName
+}
+
+func openBroker() (broker.Broker, error) {
+	if natsURL == "" {
+		return broker.NewInProcess(), nil
+	}
+
+	conn, err := nats.Connect(natsURL, nats.Name(aggregateType()+"-service"))
+	if err != nil {
+		return nil, err
+	}
+
+	return broker.NewNATS(conn, broker.WithDurable(aggregateType()+"-service"))
 }
 
 func Run() {
+	flag.Parse()
+
 	lis, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", port))
 	if err != nil {
 		log.PrintLn("transport", "grpc", "msg", "failed to create a listener", "err", err)
 	}
 
 	grpcSrv := grpc.NewServer()
-	srv := server.ArticleServer{}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	backend, err := openBackend(ctx)
+	if err != nil {
+		log.PrintLn("msg", "failed to open the storage", "storage", storageKind, "err", err)
+		return
+	}
+	events, db := backend.events, backend.model
+
+	b, err := openBroker()
+	if err != nil {
+		log.PrintLn("msg", "failed to connect to the broker", "err", err)
+		return
+	}
+	defer b.Close()
+
+	codec := cmd.NewEventCodec(aggregateType(), idgen.ULIDGenerator{})
+	repo := cmd.NewRepository(events, codec, cmd.WithSnapshots(backend.snapshots, snapshotPolicy))
+
+	runner := query.NewRunner(events, codec, db, backend.deadLetters)
+	relay := cmd.NewRelay(events, broker.NewPublisher(b, broker.Topic(projectName(), aggregateType())))
+	wake := func() {
+		runner.Wake()
+		relay.Wake()
+	}
+	storage := cmd.NewEventSourcedStorage(repo, db,
+		cmd.WithAppendHook(func([]cmd.Event) { wake() }),
+	)
+
+	// Background work is waited for on shutdown,
+	// before the storage and the broker it uses are closed.
+	var wg sync.WaitGroup
+	background := func(run func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run()
+		}()
+	}
+
+	background(func() { runner.Run(ctx) })
+	background(func() { relay.Run(ctx) })
+	if backend.listen != nil {
+		background(func() { backend.listen(ctx, wake) })
+	}
+
+	srv := server.NewArticleServer(storage, db,
+		server.WithClock(clock.System{}),
+		server.WithTombstoneRetention(retention),
+		server.WithImportMode(importMode),
+		server.WithIdempotencyTTL(idempotencyTTL),
+		server.WithValidationRules(rules),
+		server.WithHistory(repo),
+		server.WithConsistency(runner, consistencyTimeout),
+	)
+
+	background(func() { cmd.RunPurger(ctx, storage, retention, purgeInterval) })
 
 	defer func() {
+		cancel()
+		wg.Wait()
+
 		err := srv.Close(context.Background())
 		if err != nil {
 			log.PrintLn("msg", "failed to gracefully close connections", "err", err)
@@ -41,6 +189,35 @@ func Run() {
 
 	pb.RegisterArticleServiceServer(grpcSrv, srv)
 
+	// Maintenance RPCs are kept off the public listener.
+	if adminAddr != "" {
+		adminLis, err := net.Listen("tcp", adminAddr)
+		if err != nil {
+			log.PrintLn("transport", "grpc", "msg", "failed to create the admin listener", "err", err)
+			return
+		}
+
+		adminSrv := grpc.NewServer()
+		pb.RegisterAdminServiceServer(adminSrv, server.NewAdminServer(query.NewProjections(runner)))
+		defer adminSrv.Stop()
+
+		go func() {
+			if err := adminSrv.Serve(adminLis); err != nil {
+				log.PrintLn("transport", "grpc", "msg", "failed to serve admin RPCs", "err", err)
+			}
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		// Streams of changes only end when their clients leave,
+		// so whatever is left is cut off after a while.
+		timer := time.AfterFunc(shutdownTimeout, grpcSrv.Stop)
+		defer timer.Stop()
+		grpcSrv.GracefulStop()
+	}()
+
 	log.PrintLn("transport", "grpc", "msg", "listening")
 	err = grpcSrv.Serve(lis)
 	if err != nil {
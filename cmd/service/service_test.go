@@ -2,79 +2,720 @@ package service_test
 
 import (
 	"context"
+	"errors"
+	"io"
 	"log"
 	"net"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
 	"github.com/krixlion/dev-forum_article/pkg/grpc/pb"
 	"github.com/krixlion/dev-forum_article/pkg/grpc/server"
+	"github.com/krixlion/dev-forum_article/pkg/idgen"
+	"github.com/krixlion/dev-forum_article/pkg/memory"
+	"github.com/krixlion/dev-forum_article/pkg/query"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 const bufSize = 1024 * 1024
 
-var lis *bufconn.Listener
+var (
+	lis      *bufconn.Listener
+	adminLis *bufconn.Listener
+	db       *memory.DB
+	events   *memory.EventStore
+	storage  *cmd.EventSourcedStorage
+)
 
 func init() {
 	// bufconn allows the server to call itself
 	// great for testing across whole infrastructure
 	lis = bufconn.Listen(bufSize)
 	s := grpc.NewServer()
-	server := server.ArticleServer{}
-	pb.RegisterArticleServiceServer(s, server)
+	clock := clock.NewStepping(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Millisecond)
+	codec := cmd.NewEventCodec(cmd.DefaultAggregateType, idgen.NewSequenceGenerator("event-"))
+	events = memory.NewEventStore(clock)
+	db = memory.NewDB()
+	runner := query.NewRunner(events, codec, db, memory.NewDeadLetters(), query.WithPollInterval(10*time.Millisecond))
+	repo := cmd.NewRepository(events, codec)
+	storage = cmd.NewEventSourcedStorage(repo, db,
+		cmd.WithClock(clock),
+		cmd.WithAppendHook(func([]cmd.Event) { runner.Wake() }),
+	)
+	go runner.Run(context.Background())
+
+	articleServer := server.NewArticleServer(storage, db,
+		server.WithIDGenerator(idgen.NewSequenceGenerator("article-")),
+		server.WithClock(clock),
+		server.WithHistory(repo),
+		server.WithConsistency(runner, 200*time.Millisecond),
+	)
+	pb.RegisterArticleServiceServer(s, articleServer)
 	go func() {
 		if err := s.Serve(lis); err != nil {
 			log.Fatalf("Server exited with error: %v", err)
 		}
 	}()
+
+	// Maintenance RPCs have a listener of their own, as in Run.
+	adminLis = bufconn.Listen(bufSize)
+	adminSrv := grpc.NewServer()
+	pb.RegisterAdminServiceServer(adminSrv, server.NewAdminServer(query.NewProjections(runner)))
+	go func() {
+		if err := adminSrv.Serve(adminLis); err != nil {
+			log.Fatalf("Admin server exited with error: %v", err)
+		}
+	}()
 }
 
 func bufDialer(context.Context, string) (net.Conn, error) {
 	return lis.Dial()
 }
 
+func newClient(ctx context.Context, t *testing.T) pb.ArticleServiceClient {
+	t.Helper()
+
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewArticleServiceClient(conn)
+}
+
+// createArticle creates the article, waits until it is projected
+// and returns it as stored.
+func createArticle(ctx context.Context, t *testing.T, client pb.ArticleServiceClient, article *pb.Article) *pb.Article {
+	t.Helper()
+
+	resp, err := client.Create(ctx, &pb.CreateArticleRequest{Article: article})
+	if err != nil {
+		t.Fatalf("Failed to create article, err: %v", err)
+	}
+
+	waitForProjection(ctx, t)
+	return resp.GetArticle()
+}
+
+// waitForProjection blocks until the read model catches up with all appended events.
+func waitForProjection(ctx context.Context, t *testing.T) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		checkpoint, err := db.Checkpoint(ctx)
+		if err != nil {
+			t.Fatalf("Failed to read the checkpoint, err: %v", err)
+		}
+		head, err := events.Head(ctx)
+		if err != nil {
+			t.Fatalf("Failed to read the head, err: %v", err)
+		}
+		if checkpoint >= head {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Projection did not catch up, checkpoint: %v, head: %v", checkpoint, head)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func TestCreateAndGet(t *testing.T) {
-	// is := is.New(t)
 	ctx := context.Background()
+	client := newClient(ctx, t)
 
-	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	article := &pb.Article{
+		UserId: "user",
+		Title:  "title",
+		Body:   "body",
+	}
+
+	createResponse, err := client.Create(ctx, &pb.CreateArticleRequest{
+		Article: article,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create article, err: %v", err)
+	}
+
+	created := createResponse.GetArticle()
+	if created.GetId() == "" {
+		t.Fatalf("Created article was not assigned an ID")
+	}
+
+	if created.GetCreatedAt() == nil || !proto.Equal(created.GetCreatedAt(), created.GetUpdatedAt()) || !proto.Equal(created.GetCreatedAt(), created.GetPublishedAt()) {
+		t.Fatalf("Unexpected timestamps of a new article: %v", created)
+	}
+
+	// Creation and publication make two versions.
+	want := proto.Clone(article).(*pb.Article)
+	want.Id = created.GetId()
+	want.Version = 2
+	want.CreatedAt = created.GetCreatedAt()
+	want.UpdatedAt = created.GetUpdatedAt()
+	want.PublishedAt = created.GetPublishedAt()
+
+	if !proto.Equal(createResponse.GetArticle(), want) {
+		t.Fatalf("Created article is not equal, got: %v, want: %v", createResponse.GetArticle(), want)
+	}
+
+	waitForProjection(ctx, t)
+
+	resp, err := client.Get(ctx, &pb.GetArticleRequest{
+		ArticleId: want.Id,
+	})
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+
+	if !proto.Equal(resp.GetArticle(), want) {
+		t.Fatalf("Articles are not equal, got: %v, want: %v", resp.GetArticle(), want)
+	}
+}
+
+func TestGetNotFound(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(ctx, t)
+
+	_, err := client.Get(ctx, &pb.GetArticleRequest{
+		ArticleId: "non-existent",
+	})
+
+	st := status.Convert(err)
+	if st.Code() != codes.NotFound {
+		t.Fatalf("Unexpected code, got: %v, want: %v", st.Code(), codes.NotFound)
+	}
+
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			if info.GetReason() != "ARTICLE_NOT_FOUND" {
+				t.Fatalf("Unexpected reason, got: %v", info.GetReason())
+			}
+			return
+		}
+	}
+	t.Fatalf("Missing ErrorInfo in details: %v", st.Details())
+}
+
+func TestCreateInvalidArgument(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(ctx, t)
+
+	_, err := client.Create(ctx, &pb.CreateArticleRequest{
+		Article: &pb.Article{Id: "chosen-by-client", Title: "title"},
+	})
+
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("Unexpected code, got: %v, want: %v", st.Code(), codes.InvalidArgument)
+	}
+
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			if len(badRequest.GetFieldViolations()) != 2 {
+				t.Fatalf("Unexpected violations, got: %v", badRequest.GetFieldViolations())
+			}
+			return
+		}
+	}
+	t.Fatalf("Missing BadRequest in details: %v", st.Details())
+}
+
+func TestDeleteAndRestore(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(ctx, t)
+
+	article := createArticle(ctx, t, client, &pb.Article{
+		UserId: "user",
+		Title:  "title",
+		Body:   "body",
+	})
+
+	if _, err := client.Delete(ctx, &pb.DeleteArticleRequest{ArticleId: article.Id}); err != nil {
+		t.Fatalf("Failed to delete article, err: %v", err)
+	}
+
+	waitForProjection(ctx, t)
+
+	_, err := client.Get(ctx, &pb.GetArticleRequest{ArticleId: article.Id})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Deleted article is still visible, err: %v", err)
+	}
+
+	restoreResponse, err := client.Restore(ctx, &pb.RestoreArticleRequest{ArticleId: article.Id})
+	if err != nil {
+		t.Fatalf("Failed to restore article, err: %v", err)
+	}
+
+	// Delete and Restore make two more versions.
+	want := proto.Clone(article).(*pb.Article)
+	want.Version = article.GetVersion() + 2
+
+	if !proto.Equal(restoreResponse.GetArticle(), want) {
+		t.Fatalf("Restored article is not equal, got: %v, want: %v", restoreResponse.GetArticle(), want)
+	}
+
+	waitForProjection(ctx, t)
+
+	if _, err := client.Get(ctx, &pb.GetArticleRequest{ArticleId: article.Id}); err != nil {
+		t.Fatalf("Failed to get restored article, err: %v", err)
+	}
+}
+
+func TestPurgeExpiredTombstones(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(ctx, t)
+
+	article := createArticle(ctx, t, client, &pb.Article{
+		UserId: "user",
+		Title:  "title",
+	})
+
+	if _, err := client.Delete(ctx, &pb.DeleteArticleRequest{ArticleId: article.Id}); err != nil {
+		t.Fatalf("Failed to delete article, err: %v", err)
+	}
+
+	waitForProjection(ctx, t)
+
+	purged, err := storage.Purge(ctx, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("Failed to purge, err: %v", err)
+	}
+	if purged == 0 {
+		t.Fatalf("Tombstone was not purged")
+	}
+
+	_, err = client.Restore(ctx, &pb.RestoreArticleRequest{ArticleId: article.Id})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Purged article was restored, err: %v", err)
+	}
+}
+
+func TestListArticlesPagination(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(ctx, t)
+
+	// The server outlives the test, so the user must be unique to the run.
+	userId := t.Name() + "-" + idgen.ULIDGenerator{}.NewID()
+
+	var want []string
+	for i := 0; i < 3; i++ {
+		article := createArticle(ctx, t, client, &pb.Article{
+			UserId: userId,
+			Title:  "title",
+			Tags:   []string{"go"},
+		})
+		want = append(want, article.GetId())
+	}
+
+	req := &pb.ListArticlesRequest{
+		PageSize: 2,
+		Filter:   &pb.ArticleFilter{UserId: userId, Tag: "go"},
+		Order:    pb.ArticleOrder_ARTICLE_ORDER_OLDEST,
+	}
+
+	var got []string
+	for {
+		resp, err := client.ListArticles(ctx, req)
+		if err != nil {
+			t.Fatalf("Failed to list articles, err: %v", err)
+		}
+
+		for _, article := range resp.GetArticles() {
+			got = append(got, article.GetId())
+		}
+
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Unexpected articles, got: %v, want: %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Unexpected articles, got: %v, want: %v", got, want)
+		}
+	}
+
+	req.Filter.UserId = "someone-else"
+	_, err := client.ListArticles(ctx, req)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Page token was accepted for a different filter, err: %v", err)
+	}
+}
+
+func TestGetStreamWatchesChanges(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := newClient(ctx, t)
+
+	article := createArticle(ctx, t, client, &pb.Article{
+		UserId: "user",
+		Title:  "title",
+	})
+
+	stream, err := client.GetStream(ctx, &pb.GetArticleRequest{ArticleId: article.Id})
+	if err != nil {
+		t.Fatalf("Failed to open stream, err: %v", err)
+	}
+
+	current, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive current article, err: %v", err)
+	}
+	if current.GetType() != pb.ChangeType_CHANGE_TYPE_CURRENT || current.GetArticle().GetTitle() != article.Title {
+		t.Fatalf("Unexpected first message: %v", current)
+	}
+
+	updated := proto.Clone(article).(*pb.Article)
+	updated.Title = "changed by someone else"
+	if _, err := client.Update(ctx, &pb.UpdateArticleRequest{Article: updated}); err != nil {
+		t.Fatalf("Failed to update article, err: %v", err)
+	}
+
+	change, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive update, err: %v", err)
+	}
+	if change.GetType() != pb.ChangeType_CHANGE_TYPE_UPDATED || change.GetArticle().GetTitle() != updated.Title {
+		t.Fatalf("Unexpected update message: %v", change)
+	}
+
+	if _, err := client.Delete(ctx, &pb.DeleteArticleRequest{ArticleId: article.Id}); err != nil {
+		t.Fatalf("Failed to delete article, err: %v", err)
+	}
+
+	change, err = stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to receive deletion, err: %v", err)
+	}
+	if change.GetType() != pb.ChangeType_CHANGE_TYPE_DELETED {
+		t.Fatalf("Unexpected deletion message: %v", change)
+	}
+}
+
+func TestPartialUpdate(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(ctx, t)
+
+	article := createArticle(ctx, t, client, &pb.Article{
+		UserId: "user",
+		Title:  "title",
+		Body:   "body",
+	})
+
+	resp, err := client.Update(ctx, &pb.UpdateArticleRequest{
+		Article:    &pb.Article{Id: article.Id, Title: "new title"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update article, err: %v", err)
+	}
+
+	if !resp.GetArticle().GetUpdatedAt().AsTime().After(article.GetUpdatedAt().AsTime()) {
+		t.Fatalf("updated_at was not advanced, got: %v, previously: %v", resp.GetArticle().GetUpdatedAt(), article.GetUpdatedAt())
+	}
+
+	want := proto.Clone(article).(*pb.Article)
+	want.Title = "new title"
+	want.Version = article.GetVersion() + 1
+	want.UpdatedAt = resp.GetArticle().GetUpdatedAt()
+	if !proto.Equal(resp.GetArticle(), want) {
+		t.Fatalf("Unexpected article, got: %v, want: %v", resp.GetArticle(), want)
+	}
+
+	for _, path := range []string{"user_id", "id", "unknown"} {
+		_, err := client.Update(ctx, &pb.UpdateArticleRequest{
+			Article:    &pb.Article{Id: article.Id, UserId: "intruder"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{path}},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Path %q was not rejected, err: %v", path, err)
+		}
+	}
+}
+
+func TestUpdateVersionConflict(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(ctx, t)
+
+	article := createArticle(ctx, t, client, &pb.Article{
+		UserId: "user",
+		Title:  "title",
+	})
+
+	version := article.GetVersion()
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"title"}}
+
+	first, err := client.Update(ctx, &pb.UpdateArticleRequest{
+		Article:         &pb.Article{Id: article.Id, Title: "first editor"},
+		UpdateMask:      mask,
+		ExpectedVersion: version,
+	})
+	if err != nil {
+		t.Fatalf("Failed to update article, err: %v", err)
+	}
+
+	if first.GetArticle().GetVersion() != version+1 {
+		t.Fatalf("Version was not incremented, got: %v, want: %v", first.GetArticle().GetVersion(), version+1)
+	}
+
+	_, err = client.Update(ctx, &pb.UpdateArticleRequest{
+		Article:         &pb.Article{Id: article.Id, Title: "second editor"},
+		UpdateMask:      mask,
+		ExpectedVersion: version,
+	})
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("Stale update was not aborted, err: %v", err)
+	}
+}
+
+func TestCreateIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(ctx, t)
+
+	req := &pb.CreateArticleRequest{
+		Article:        &pb.Article{UserId: "user", Title: "title"},
+		IdempotencyKey: "create-once",
+	}
+
+	first, err := client.Create(ctx, req)
+	if err != nil {
+		t.Fatalf("Failed to create article, err: %v", err)
+	}
+
+	// A retry sending the key as metadata must be answered with the original response.
+	retryCtx := metadata.AppendToOutgoingContext(ctx, "idempotency-key", "create-once")
+	retry, err := client.Create(retryCtx, &pb.CreateArticleRequest{Article: req.Article})
+	if err != nil {
+		t.Fatalf("Failed to retry create, err: %v", err)
+	}
+
+	if !proto.Equal(first, retry) {
+		t.Fatalf("Retry returned a different response, got: %v, want: %v", retry, first)
+	}
+
+	_, err = client.Create(ctx, &pb.CreateArticleRequest{
+		Article:        &pb.Article{UserId: "user", Title: "other title"},
+		IdempotencyKey: "create-once",
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Reused key with a different payload was not rejected, err: %v", err)
+	}
+}
+
+func TestContentValidation(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(ctx, t)
+
+	article := createArticle(ctx, t, client, &pb.Article{
+		UserId: "user",
+		Title:  "  Cafe\u0301\x07 ",
+		Body:   "line\r\nnext\x00",
+	})
+
+	if article.GetTitle() != "Caf\u00e9" || article.GetBody() != "line\nnext" {
+		t.Fatalf("Content was not normalized, got title: %q, body: %q", article.GetTitle(), article.GetBody())
+	}
+
+	_, err := client.Create(ctx, &pb.CreateArticleRequest{
+		Article: &pb.Article{Title: " ", Body: strings.Repeat("a", 1<<20+1)},
+	})
+
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("Unexpected code, got: %v, want: %v", st.Code(), codes.InvalidArgument)
+	}
+
+	var fields []string
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, violation := range badRequest.GetFieldViolations() {
+				fields = append(fields, violation.GetField())
+			}
+		}
+	}
+
+	want := []string{"article.title", "article.body", "article.user_id"}
+	if strings.Join(fields, ",") != strings.Join(want, ",") {
+		t.Fatalf("Unexpected violations, got: %v, want: %v", fields, want)
+	}
+
+	_, err = client.Update(ctx, &pb.UpdateArticleRequest{
+		Article:    &pb.Article{Id: article.Id, Title: "\t"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title"}},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Empty title was accepted by update, err: %v", err)
+	}
+}
+
+func TestRebuildProjections(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(ctx, t)
+
+	article := createArticle(ctx, t, client, &pb.Article{
+		UserId: "user",
+		Title:  "title",
+	})
+
+	public, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+	defer public.Close()
+
+	// The public listener does not serve maintenance RPCs.
+	stream, err := pb.NewAdminServiceClient(public).RebuildProjections(ctx, &pb.RebuildProjectionsRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("Admin RPCs are served on the public listener, err: %v", err)
+	}
+
+	adminDialer := func(context.Context, string) (net.Conn, error) { return adminLis.Dial() }
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(adminDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		t.Fatalf("Failed to dial bufnet: %v", err)
 	}
 	defer conn.Close()
 
-	// client := pb.NewArticleServiceClient(conn)
-
-	// event := &pb.Event{
-	// 	EventId:       "2345",
-	// 	EventType:     "UserCreated",
-	// 	AggregateId:   "user",
-	// 	AggregateType: "service",
-	// 	EventData:     "name: imie",
-	// 	// ChannelName:   "user",
-	// }
-	// createResponse, err := client.Create(ctx, &pb.CreateEventRequest{
-	// 	Event: event,
-	// })
-
-	// 	if !createResponse.IsSuccess {
-	// 		t.Fatalf("Failed to create event, err: %v", err)
-	// 	}
-
-	// 	resp, err := client.Get(ctx, &pb.GetEventsRequest{
-	// 		EventId:     "2345",
-	// 		AggregateId: "user",
-	// 	})
-	// 	if err != nil {
-	// 		t.Fatalf("Failed to get: %v", err)
-	// 	}
-
-	//	want := &pb.GetEventsResponse{
-	//		Event: event,
-	//	}
-	//
-	// is.Equal(resp, want)
+	admin := pb.NewAdminServiceClient(conn)
+
+	stream, err = admin.RebuildProjections(ctx, &pb.RebuildProjectionsRequest{Projections: []string{"unknown"}})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Unknown projection was not rejected, err: %v", err)
+	}
+
+	stream, err = admin.RebuildProjections(ctx, &pb.RebuildProjectionsRequest{})
+	if err != nil {
+		t.Fatalf("Failed to rebuild projections, err: %v", err)
+	}
+
+	var last *pb.RebuildProgress
+	for {
+		progress, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to receive progress, err: %v", err)
+		}
+		last = progress
+	}
+
+	if !last.GetDone() || last.GetProjection() != query.DefaultProjectionName || last.GetPosition() == 0 {
+		t.Fatalf("Unexpected final progress: %v", last)
+	}
+
+	resp, err := client.Get(ctx, &pb.GetArticleRequest{ArticleId: article.Id})
+	if err != nil {
+		t.Fatalf("Failed to get article after the rebuild, err: %v", err)
+	}
+	if !proto.Equal(resp.GetArticle(), article) {
+		t.Fatalf("Rebuilt article is not equal, got: %v, want: %v", resp.GetArticle(), article)
+	}
+}
+
+func TestGetAsOf(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(ctx, t)
+
+	article := createArticle(ctx, t, client, &pb.Article{
+		UserId: "user",
+		Title:  "title",
+		Body:   "body",
+	})
+
+	for _, title := range []string{"second title", "third title"} {
+		_, err := client.Update(ctx, &pb.UpdateArticleRequest{
+			Article:    &pb.Article{Id: article.Id, Title: title},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title"}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update article, err: %v", err)
+		}
+	}
+
+	resp, err := client.Get(ctx, &pb.GetArticleRequest{ArticleId: article.Id, AsOfVersion: article.GetVersion() + 1})
+	if err != nil {
+		t.Fatalf("Failed to get article as of version, err: %v", err)
+	}
+	if resp.GetArticle().GetTitle() != "second title" || resp.GetArticle().GetVersion() != article.GetVersion()+1 {
+		t.Fatalf("Unexpected article as of version, got: %v", resp.GetArticle())
+	}
+
+	resp, err = client.Get(ctx, &pb.GetArticleRequest{ArticleId: article.Id, AsOfTime: article.GetUpdatedAt()})
+	if err != nil {
+		t.Fatalf("Failed to get article as of time, err: %v", err)
+	}
+	if !proto.Equal(resp.GetArticle(), article) {
+		t.Fatalf("Unexpected article as of time, got: %v, want: %v", resp.GetArticle(), article)
+	}
+
+	before := timestamppb.New(article.GetCreatedAt().AsTime().Add(-time.Second))
+	_, err = client.Get(ctx, &pb.GetArticleRequest{ArticleId: article.Id, AsOfTime: before})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Article before its creation was found, err: %v", err)
+	}
+}
+
+func TestConsistencyToken(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(ctx, t)
+
+	created, err := client.Create(ctx, &pb.CreateArticleRequest{
+		Article: &pb.Article{UserId: "user", Title: "title", Body: "body"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create article, err: %v", err)
+	}
+	if created.GetConsistencyToken() == "" {
+		t.Fatal("Create did not return a consistency token")
+	}
+
+	// Without waiting for the projection the token alone
+	// has to make the read reflect the write.
+	got, err := client.Get(ctx, &pb.GetArticleRequest{
+		ArticleId:        created.GetArticle().GetId(),
+		ConsistencyToken: created.GetConsistencyToken(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to get article, err: %v", err)
+	}
+	if !proto.Equal(got.GetArticle(), created.GetArticle()) {
+		t.Fatalf("Read does not reflect the write, got: %v, want: %v", got.GetArticle(), created.GetArticle())
+	}
+
+	unreachable := query.EncodeConsistencyToken(1 << 40)
+	_, err = client.Get(ctx, &pb.GetArticleRequest{ArticleId: created.GetArticle().GetId(), ConsistencyToken: unreachable})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("Read of an unreachable token did not fail with Unavailable, err: %v", err)
+	}
+
+	_, err = client.ListArticles(ctx, &pb.ListArticlesRequest{ConsistencyToken: "malformed!"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Malformed token was not rejected, err: %v", err)
+	}
 }
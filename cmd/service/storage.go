@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/filestore"
+	"github.com/krixlion/dev-forum_article/pkg/log"
+	"github.com/krixlion/dev-forum_article/pkg/memory"
+	"github.com/krixlion/dev-forum_article/pkg/migrate"
+	"github.com/krixlion/dev-forum_article/pkg/postgres"
+	"github.com/krixlion/dev-forum_article/pkg/query"
+	"github.com/krixlion/dev-forum_article/pkg/sqlite"
+)
+
+// Values of the -storage flag.
+const (
+	storageMemory   = "memory"
+	storageFile     = "file"
+	storageSQLite   = "sqlite"
+	storagePostgres = "postgres"
+)
+
+// eventStore is implemented by every store events are published from.
+type eventStore interface {
+	cmd.EventStore
+	cmd.Outbox
+}
+
+// readModel is implemented by every read model the service can run on.
+type readModel interface {
+	query.Rebuildable
+	cmd.TombstoneFinder
+}
+
+type backend struct {
+	events      eventStore
+	snapshots   cmd.SnapshotStore
+	model       readModel
+	deadLetters query.DeadLetters
+	// listen, if set, calls wake whenever events are appended
+	// by any replica, until ctx is cancelled.
+	listen func(ctx context.Context, wake func()) error
+}
+
+func openBackend(ctx context.Context) (backend, error) {
+	switch storageKind {
+	case storageMemory:
+		return backend{
+			events:      memory.NewEventStore(clock.System{}),
+			snapshots:   memory.NewSnapshots(),
+			model:       memory.NewDB(),
+			deadLetters: memory.NewDeadLetters(),
+		}, nil
+	case storageFile:
+		return openFileBackend()
+	case storageSQLite:
+		return openSQLiteBackend(ctx)
+	case storagePostgres:
+		return openPostgresBackend(ctx)
+	default:
+		return backend{}, fmt.Errorf("unknown storage %q", storageKind)
+	}
+}
+
+// openFileBackend keeps events and snapshots in -data-dir
+// and projects them into memory on every start.
+func openFileBackend() (backend, error) {
+	if dataDir == "" {
+		return backend{}, errors.New("-data-dir must be set")
+	}
+
+	events, err := filestore.Open(dataDir)
+	if err != nil {
+		return backend{}, err
+	}
+
+	snapshots, err := filestore.OpenSnapshots(filepath.Join(dataDir, "snapshots"))
+	if err != nil {
+		events.Close()
+		return backend{}, err
+	}
+
+	return backend{
+		events:      events,
+		snapshots:   snapshots,
+		model:       memory.NewDB(),
+		deadLetters: memory.NewDeadLetters(),
+	}, nil
+}
+
+// openSQLiteBackend reads the paths of the databases from
+// DB_WRITE_DBNAME and DB_READ_DBNAME, which may be the same file.
+func openSQLiteBackend(ctx context.Context) (backend, error) {
+	dbs, err := openSQLiteDatabases(ctx)
+	if err != nil {
+		return backend{}, err
+	}
+
+	if autoMigrate {
+		if err := migrateUp(ctx, dbs); err != nil {
+			closeDatabases(dbs)
+			return backend{}, err
+		}
+	}
+
+	return backend{
+		events:      sqlite.NewEventStore(dbs[0].db, clock.System{}),
+		snapshots:   sqlite.NewSnapshots(dbs[0].db),
+		model:       sqlite.NewReadModel(dbs[1].db),
+		deadLetters: sqlite.NewDeadLetters(dbs[1].db),
+	}, nil
+}
+
+// database is one of the databases of a backend
+// together with the migrations of its schema.
+type database struct {
+	name     string
+	db       *sql.DB
+	migrator *migrate.Migrator
+}
+
+// openDatabases opens the databases of the -storage backend, the one
+// holding the events first. Backends without a schema have none.
+func openDatabases(ctx context.Context) ([]database, error) {
+	switch storageKind {
+	case storageSQLite:
+		return openSQLiteDatabases(ctx)
+	case storagePostgres:
+		return openPostgresDatabases(ctx)
+	case storageMemory, storageFile:
+		return nil, fmt.Errorf("storage %q has no migrations", storageKind)
+	default:
+		return nil, fmt.Errorf("unknown storage %q", storageKind)
+	}
+}
+
+func openSQLiteDatabases(ctx context.Context) ([]database, error) {
+	writePath, readPath := os.Getenv("DB_WRITE_DBNAME"), os.Getenv("DB_READ_DBNAME")
+	if writePath == "" || readPath == "" {
+		return nil, errors.New("DB_WRITE_DBNAME and DB_READ_DBNAME must be set")
+	}
+
+	// SQLite has a single writer, more connections would only wait for the lock.
+	writeDB, err := sqlite.Open(ctx, writePath, sqlite.WithMaxOpenConns(1), sqlite.WithMaxIdleConns(1))
+	if err != nil {
+		return nil, err
+	}
+
+	readDB, err := sqlite.Open(ctx, readPath)
+	if err != nil {
+		writeDB.Close()
+		return nil, err
+	}
+
+	writeMigrator, err := sqlite.NewWriteMigrator(writeDB)
+	if err != nil {
+		writeDB.Close()
+		readDB.Close()
+		return nil, err
+	}
+
+	readMigrator, err := sqlite.NewReadMigrator(readDB)
+	if err != nil {
+		writeDB.Close()
+		readDB.Close()
+		return nil, err
+	}
+
+	return []database{
+		{name: "write", db: writeDB, migrator: writeMigrator},
+		{name: "read", db: readDB, migrator: readMigrator},
+	}, nil
+}
+
+// openPostgresBackend connects to the databases described by DB_WRITE_*
+// and DB_READ_*, which may be the same one. Each has a pool of its own.
+func openPostgresBackend(ctx context.Context) (backend, error) {
+	// Events are appended to the write database, which is where they are notified.
+	writeConfig, err := postgresConfig("DB_WRITE_")
+	if err != nil {
+		return backend{}, err
+	}
+
+	dbs, err := openPostgresDatabases(ctx)
+	if err != nil {
+		return backend{}, err
+	}
+
+	if autoMigrate {
+		if err := migrateUp(ctx, dbs); err != nil {
+			closeDatabases(dbs)
+			return backend{}, err
+		}
+	}
+
+	return backend{
+		events:      postgres.NewEventStore(dbs[0].db, clock.System{}),
+		snapshots:   postgres.NewSnapshots(dbs[0].db),
+		model:       postgres.NewReadModel(dbs[1].db),
+		deadLetters: postgres.NewDeadLetters(dbs[1].db),
+		listen: func(ctx context.Context, wake func()) error {
+			return postgres.Listen(ctx, writeConfig, wake)
+		},
+	}, nil
+}
+
+// pool holds the flags of a connection pool.
+type pool struct {
+	maxConns         int
+	connLifetime     time.Duration
+	statementTimeout time.Duration
+}
+
+func (p pool) options() []postgres.Option {
+	return []postgres.Option{
+		postgres.WithMaxOpenConns(p.maxConns),
+		postgres.WithMaxIdleConns(p.maxConns),
+		postgres.WithConnMaxLifetime(p.connLifetime),
+		postgres.WithStatementTimeout(p.statementTimeout),
+	}
+}
+
+// postgresConfig reads the location of a database
+// from environment variables starting with prefix.
+func postgresConfig(prefix string) (postgres.Config, error) {
+	config := postgres.Config{
+		Host:     os.Getenv(prefix + "HOST"),
+		Port:     os.Getenv(prefix + "PORT"),
+		DBName:   os.Getenv(prefix + "DBNAME"),
+		User:     os.Getenv(prefix + "USER"),
+		Password: os.Getenv(prefix + "PASS"),
+	}
+	if config.DBName == "" {
+		return postgres.Config{}, fmt.Errorf("%sDBNAME must be set", prefix)
+	}
+	return config, nil
+}
+
+func openPostgresDatabases(ctx context.Context) ([]database, error) {
+	writeConfig, err := postgresConfig("DB_WRITE_")
+	if err != nil {
+		return nil, err
+	}
+	readConfig, err := postgresConfig("DB_READ_")
+	if err != nil {
+		return nil, err
+	}
+
+	writeDB, err := postgres.Open(ctx, writeConfig, writePool.options()...)
+	if err != nil {
+		return nil, err
+	}
+
+	readDB, err := postgres.Open(ctx, readConfig, readPool.options()...)
+	if err != nil {
+		writeDB.Close()
+		return nil, err
+	}
+
+	writeMigrator, err := postgres.NewWriteMigrator(writeDB)
+	if err != nil {
+		writeDB.Close()
+		readDB.Close()
+		return nil, err
+	}
+
+	readMigrator, err := postgres.NewReadMigrator(readDB)
+	if err != nil {
+		writeDB.Close()
+		readDB.Close()
+		return nil, err
+	}
+
+	return []database{
+		{name: "write", db: writeDB, migrator: writeMigrator},
+		{name: "read", db: readDB, migrator: readMigrator},
+	}, nil
+}
+
+func closeDatabases(dbs []database) {
+	for _, db := range dbs {
+		db.db.Close()
+	}
+}
+
+// migrateUp applies pending migrations of all databases and logs them.
+func migrateUp(ctx context.Context, dbs []database) error {
+	for _, db := range dbs {
+		applied, err := db.migrator.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to migrate the %s database: %w", db.name, err)
+		}
+		for _, migration := range applied {
+			log.PrintLn("msg", "applied migration", "database", db.name, "version", migration.Version, "name", migration.Name)
+		}
+	}
+	return nil
+}
@@ -1,4 +1,312 @@
 package entity
 
+import (
+	"fmt"
+	"time"
+)
+
+// Article is the aggregate root of the service.
+// Its fields are exported for storage and conversion, but changes
+// should go through its methods, which enforce the invariants
+// and record an event for every change.
 type Article struct {
+	Id     string
+	UserId string
+	Title  string
+	Body   string
+	Tags   []string
+	// Version is the number of events applied to the article.
+	Version   int64
+	CreatedAt time.Time
+	// UpdatedAt changes whenever the title, body or tags change.
+	UpdatedAt time.Time
+	// PublishedAt is zero until the article is published.
+	PublishedAt time.Time
+	// DeletedAt is zero unless the article is deleted.
+	DeletedAt time.Time
+	// Purged articles are deleted permanently and reported as not found.
+	Purged bool
+
+	// events are recorded since the last call to ClearEvents.
+	events []Event
+}
+
+// NewArticle returns an unpublished article and records ArticleCreated.
+func NewArticle(id, userId, title, body string, tags []string, now time.Time) (Article, error) {
+	var violations []FieldViolation
+	if id == "" {
+		violations = append(violations, FieldViolation{Field: "article.id", Description: "must not be empty"})
+	}
+	if userId == "" {
+		violations = append(violations, FieldViolation{Field: "article.user_id", Description: "must not be empty"})
+	}
+	violations = append(violations, titleViolations(title)...)
+	violations = append(violations, tagViolations(tags)...)
+
+	if len(violations) > 0 {
+		return Article{}, InvalidArgument(violations...)
+	}
+
+	var a Article
+	a.record(ArticleCreated{
+		ArticleId: id,
+		UserId:    userId,
+		Title:     title,
+		Body:      body,
+		Tags:      copyTags(tags),
+		At:        now,
+	})
+	return a, nil
+}
+
+// Replay rebuilds an article from its events in the order they were
+// recorded. The first event must be ArticleCreated.
+func Replay(events []Event) (Article, error) {
+	var a Article
+	for _, event := range events {
+		if err := a.Apply(event); err != nil {
+			return Article{}, err
+		}
+	}
+	return a, nil
+}
+
+// Apply changes the state of the article according to an event
+// recorded earlier and increments its version. It does not record
+// the event again.
+func (a *Article) Apply(event Event) error {
+	if _, ok := event.(ArticleCreated); ok != (a.Version == 0) {
+		return fmt.Errorf("cannot apply %T to article %q at version %d", event, a.Id, a.Version)
+	}
+	if a.Version > 0 && event.AggregateId() != a.Id {
+		return fmt.Errorf("cannot apply event of article %q to article %q", event.AggregateId(), a.Id)
+	}
+
+	switch e := event.(type) {
+	case ArticleCreated:
+		a.Id = e.ArticleId
+		a.UserId = e.UserId
+		a.Title = e.Title
+		a.Body = e.Body
+		a.Tags = copyTags(e.Tags)
+		a.CreatedAt = e.At
+		a.UpdatedAt = e.At
+	case ArticleTitleChanged:
+		a.Title = e.Title
+		a.UpdatedAt = e.At
+	case ArticleBodyEdited:
+		a.Body = e.Body
+		a.UpdatedAt = e.At
+	case ArticleTagsChanged:
+		a.Tags = copyTags(e.Tags)
+		a.UpdatedAt = e.At
+	case ArticlePublished:
+		a.PublishedAt = e.At
+	case ArticleDeleted:
+		a.DeletedAt = e.At
+	case ArticleRestored:
+		a.DeletedAt = time.Time{}
+	case ArticlePurged:
+		// The content of earlier events is scrubbed by the purge.
+		a.UserId = ""
+		a.Title = ""
+		a.Body = ""
+		a.Tags = nil
+		a.Purged = true
+	default:
+		return fmt.Errorf("unknown event %T", event)
+	}
+
+	a.Version++
+	return nil
+}
+
+// Rename changes the title, which must not be empty.
+// Setting the current title is a no-op.
+func (a *Article) Rename(title string, now time.Time) error {
+	if err := a.ensureLive(); err != nil {
+		return err
+	}
+	if a.Title == title {
+		return nil
+	}
+	if violations := titleViolations(title); len(violations) > 0 {
+		return InvalidArgument(violations...)
+	}
+
+	a.record(ArticleTitleChanged{ArticleId: a.Id, Title: title, At: now})
+	return nil
+}
+
+// EditBody replaces the body. Articles may be created without one,
+// but once written it cannot be emptied. Setting the current body is a no-op.
+func (a *Article) EditBody(body string, now time.Time) error {
+	if err := a.ensureLive(); err != nil {
+		return err
+	}
+	if a.Body == body {
+		return nil
+	}
+	if body == "" {
+		return InvalidArgument(FieldViolation{Field: "article.body", Description: "must not be empty"})
+	}
+
+	a.record(ArticleBodyEdited{ArticleId: a.Id, Body: body, At: now})
+	return nil
+}
+
+// Retag replaces the tags, which must be unique and not empty.
+// Setting the current tags is a no-op.
+func (a *Article) Retag(tags []string, now time.Time) error {
+	if err := a.ensureLive(); err != nil {
+		return err
+	}
+	if violations := tagViolations(tags); len(violations) > 0 {
+		return InvalidArgument(violations...)
+	}
+
+	if equalTags(a.Tags, tags) {
+		return nil
+	}
+
+	a.record(ArticleTagsChanged{ArticleId: a.Id, Tags: copyTags(tags), At: now})
+	return nil
+}
+
+// Publish makes the article visible to readers.
+// An article can only be published once.
+func (a *Article) Publish(now time.Time) error {
+	if err := a.ensureLive(); err != nil {
+		return err
+	}
+	if a.IsPublished() {
+		return Conflict(
+			"ARTICLE_ALREADY_PUBLISHED",
+			fmt.Sprintf("article %q is already published", a.Id),
+			map[string]string{"article_id": a.Id},
+		)
+	}
+
+	a.record(ArticlePublished{ArticleId: a.Id, At: now})
+	return nil
+}
+
+// Delete turns the article into a tombstone.
+// Deleted articles are reported as not found.
+func (a *Article) Delete(now time.Time) error {
+	if a.IsDeleted() {
+		return NotFound(a.Id)
+	}
+
+	a.record(ArticleDeleted{ArticleId: a.Id, At: now})
+	return nil
+}
+
+// Restore revives a deleted article.
+// Restoring an article which is not deleted is a no-op.
+func (a *Article) Restore(now time.Time) error {
+	if a.Purged {
+		return NotFound(a.Id)
+	}
+
+	if a.IsDeleted() {
+		a.record(ArticleRestored{ArticleId: a.Id, At: now})
+	}
+	return nil
+}
+
+// Purge permanently removes a deleted article.
+func (a *Article) Purge(now time.Time) error {
+	if !a.IsDeleted() || a.Purged {
+		return NotFound(a.Id)
+	}
+
+	a.record(ArticlePurged{ArticleId: a.Id, At: now})
+	return nil
+}
+
+// ensureLive reports deleted and purged articles as not found,
+// since only live articles can be changed.
+func (a Article) ensureLive() error {
+	if a.IsDeleted() || a.Purged {
+		return NotFound(a.Id)
+	}
+	return nil
+}
+
+func (a Article) IsPublished() bool {
+	return !a.PublishedAt.IsZero()
+}
+
+func (a Article) IsDeleted() bool {
+	return !a.DeletedAt.IsZero()
+}
+
+// Events returns the events recorded since the last call to ClearEvents.
+func (a Article) Events() []Event {
+	return append([]Event(nil), a.events...)
+}
+
+// ClearEvents forgets the recorded events once they have been handled.
+func (a *Article) ClearEvents() {
+	a.events = nil
+}
+
+// Clone returns a deep copy of the article including its recorded events.
+func (a Article) Clone() Article {
+	clone := a
+	clone.Tags = copyTags(a.Tags)
+	clone.events = a.Events()
+	return clone
+}
+
+// record applies a new event and keeps it until ClearEvents is called.
+// Events recorded by the methods are always applicable.
+func (a *Article) record(event Event) {
+	if err := a.Apply(event); err != nil {
+		panic(err)
+	}
+	a.events = append(a.events, event)
+}
+
+func titleViolations(title string) []FieldViolation {
+	if title == "" {
+		return []FieldViolation{{Field: "article.title", Description: "must not be empty"}}
+	}
+	return nil
+}
+
+func tagViolations(tags []string) []FieldViolation {
+	var violations []FieldViolation
+	seen := make(map[string]bool, len(tags))
+	for i, tag := range tags {
+		field := fmt.Sprintf("article.tags[%d]", i)
+		switch {
+		case tag == "":
+			violations = append(violations, FieldViolation{Field: field, Description: "must not be empty"})
+		case seen[tag]:
+			violations = append(violations, FieldViolation{Field: field, Description: fmt.Sprintf("duplicates tag %q", tag)})
+		}
+		seen[tag] = true
+	}
+	return violations
+}
+
+func equalTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func copyTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	return append([]string(nil), tags...)
 }
@@ -0,0 +1,389 @@
+package entity_test
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+)
+
+var (
+	createdAt = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	now       = createdAt.Add(time.Hour)
+)
+
+// articleAfter replays events following the creation of article "a".
+func articleAfter(t *testing.T, events ...entity.Event) entity.Article {
+	t.Helper()
+
+	created := entity.ArticleCreated{ArticleId: "a", UserId: "user", Title: "title", Body: "body", Tags: []string{"go"}, At: createdAt}
+	article, err := entity.Replay(append([]entity.Event{created}, events...))
+	if err != nil {
+		t.Fatalf("Failed to replay article, err: %v", err)
+	}
+	return article
+}
+
+func violatedFields(err error) []string {
+	var fields []string
+	for _, v := range entity.Violations(err) {
+		fields = append(fields, v.Field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestNewArticle(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		userId string
+		title  string
+		tags   []string
+		// fields are the violated fields, none if the article is created.
+		fields []string
+	}{
+		{name: "valid", id: "a", userId: "user", title: "title", tags: []string{"go"}},
+		{name: "without body and tags", id: "a", userId: "user", title: "title"},
+		{name: "empty id", userId: "user", title: "title", fields: []string{"article.id"}},
+		{name: "empty user", id: "a", title: "title", fields: []string{"article.user_id"}},
+		{name: "empty title", id: "a", userId: "user", fields: []string{"article.title"}},
+		{name: "empty tag", id: "a", userId: "user", title: "title", tags: []string{"go", ""}, fields: []string{"article.tags[1]"}},
+		{name: "duplicate tag", id: "a", userId: "user", title: "title", tags: []string{"go", "go"}, fields: []string{"article.tags[1]"}},
+		{name: "everything empty", fields: []string{"article.id", "article.title", "article.user_id"}},
+	}
+
+	for _, test := range tests {
+		article, err := entity.NewArticle(test.id, test.userId, test.title, "", test.tags, now)
+
+		if test.fields != nil {
+			if !errors.Is(err, entity.ErrInvalidArgument) || !reflect.DeepEqual(violatedFields(err), test.fields) {
+				t.Errorf("%s: unexpected error, got: %v, want violations of: %v", test.name, err, test.fields)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: failed to create article, err: %v", test.name, err)
+			continue
+		}
+
+		want := []entity.Event{entity.ArticleCreated{ArticleId: test.id, UserId: test.userId, Title: test.title, Tags: test.tags, At: now}}
+		if !reflect.DeepEqual(article.Events(), want) || article.Version != 1 {
+			t.Errorf("%s: unexpected events: %+v, version: %v", test.name, article.Events(), article.Version)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	deleted := articleAfter(t, entity.ArticleDeleted{ArticleId: "a", At: createdAt})
+	purged := articleAfter(t, entity.ArticleDeleted{ArticleId: "a", At: createdAt}, entity.ArticlePurged{ArticleId: "a", At: createdAt})
+	published := articleAfter(t, entity.ArticlePublished{ArticleId: "a", At: createdAt})
+	live := articleAfter(t)
+
+	tests := []struct {
+		name    string
+		article entity.Article
+		command func(a *entity.Article) error
+		// event is the one recorded by the command, nil if the command is a no-op or fails.
+		event entity.Event
+		// err is matched with errors.Is.
+		err error
+	}{
+		{
+			name:    "rename",
+			article: live,
+			command: func(a *entity.Article) error { return a.Rename("renamed", now) },
+			event:   entity.ArticleTitleChanged{ArticleId: "a", Title: "renamed", At: now},
+		},
+		{
+			name:    "rename to the current title",
+			article: live,
+			command: func(a *entity.Article) error { return a.Rename("title", now) },
+		},
+		{
+			name:    "rename to an empty title",
+			article: live,
+			command: func(a *entity.Article) error { return a.Rename("", now) },
+			err:     entity.ErrInvalidArgument,
+		},
+		{
+			name:    "rename deleted",
+			article: deleted,
+			command: func(a *entity.Article) error { return a.Rename("renamed", now) },
+			err:     entity.ErrNotFound,
+		},
+		{
+			name:    "rename purged",
+			article: purged,
+			command: func(a *entity.Article) error { return a.Rename("renamed", now) },
+			err:     entity.ErrNotFound,
+		},
+		{
+			name:    "edit body",
+			article: live,
+			command: func(a *entity.Article) error { return a.EditBody("edited", now) },
+			event:   entity.ArticleBodyEdited{ArticleId: "a", Body: "edited", At: now},
+		},
+		{
+			name:    "edit body to the current body",
+			article: live,
+			command: func(a *entity.Article) error { return a.EditBody("body", now) },
+		},
+		{
+			name:    "edit body to an empty body",
+			article: live,
+			command: func(a *entity.Article) error { return a.EditBody("", now) },
+			err:     entity.ErrInvalidArgument,
+		},
+		{
+			name:    "edit body of deleted",
+			article: deleted,
+			command: func(a *entity.Article) error { return a.EditBody("edited", now) },
+			err:     entity.ErrNotFound,
+		},
+		{
+			name:    "edit body of purged",
+			article: purged,
+			command: func(a *entity.Article) error { return a.EditBody("edited", now) },
+			err:     entity.ErrNotFound,
+		},
+		{
+			name:    "retag",
+			article: live,
+			command: func(a *entity.Article) error { return a.Retag([]string{"go", "db"}, now) },
+			event:   entity.ArticleTagsChanged{ArticleId: "a", Tags: []string{"go", "db"}, At: now},
+		},
+		{
+			name:    "retag with the current tags",
+			article: live,
+			command: func(a *entity.Article) error { return a.Retag([]string{"go"}, now) },
+		},
+		{
+			name:    "retag with duplicates",
+			article: live,
+			command: func(a *entity.Article) error { return a.Retag([]string{"db", "db"}, now) },
+			err:     entity.ErrInvalidArgument,
+		},
+		{
+			name:    "retag deleted",
+			article: deleted,
+			command: func(a *entity.Article) error { return a.Retag(nil, now) },
+			err:     entity.ErrNotFound,
+		},
+		{
+			name:    "publish",
+			article: live,
+			command: func(a *entity.Article) error { return a.Publish(now) },
+			event:   entity.ArticlePublished{ArticleId: "a", At: now},
+		},
+		{
+			name:    "publish published",
+			article: published,
+			command: func(a *entity.Article) error { return a.Publish(now) },
+			err:     entity.ErrConflict,
+		},
+		{
+			name:    "publish deleted",
+			article: deleted,
+			command: func(a *entity.Article) error { return a.Publish(now) },
+			err:     entity.ErrNotFound,
+		},
+		{
+			name:    "delete",
+			article: live,
+			command: func(a *entity.Article) error { return a.Delete(now) },
+			event:   entity.ArticleDeleted{ArticleId: "a", At: now},
+		},
+		{
+			name:    "delete deleted",
+			article: deleted,
+			command: func(a *entity.Article) error { return a.Delete(now) },
+			err:     entity.ErrNotFound,
+		},
+		{
+			name:    "restore",
+			article: deleted,
+			command: func(a *entity.Article) error { return a.Restore(now) },
+			event:   entity.ArticleRestored{ArticleId: "a", At: now},
+		},
+		{
+			name:    "restore live",
+			article: live,
+			command: func(a *entity.Article) error { return a.Restore(now) },
+		},
+		{
+			name:    "restore purged",
+			article: purged,
+			command: func(a *entity.Article) error { return a.Restore(now) },
+			err:     entity.ErrNotFound,
+		},
+		{
+			name:    "purge",
+			article: deleted,
+			command: func(a *entity.Article) error { return a.Purge(now) },
+			event:   entity.ArticlePurged{ArticleId: "a", At: now},
+		},
+		{
+			name:    "purge live",
+			article: live,
+			command: func(a *entity.Article) error { return a.Purge(now) },
+			err:     entity.ErrNotFound,
+		},
+		{
+			name:    "purge purged",
+			article: purged,
+			command: func(a *entity.Article) error { return a.Purge(now) },
+			err:     entity.ErrNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		article := test.article.Clone()
+		err := test.command(&article)
+
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("%s: unexpected error, got: %v, want: %v", test.name, err, test.err)
+			}
+			if !reflect.DeepEqual(article, test.article) {
+				t.Errorf("%s: failed command changed the article: %+v", test.name, article)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: command failed, err: %v", test.name, err)
+			continue
+		}
+
+		if test.event == nil {
+			if !reflect.DeepEqual(article, test.article) {
+				t.Errorf("%s: no-op changed the article: %+v", test.name, article)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(article.Events(), []entity.Event{test.event}) || article.Version != test.article.Version+1 {
+			t.Errorf("%s: unexpected events: %+v, version: %v", test.name, article.Events(), article.Version)
+		}
+	}
+}
+
+// unknownEvent is not an event of articles.
+type unknownEvent struct{}
+
+func (unknownEvent) AggregateId() string   { return "a" }
+func (unknownEvent) OccurredAt() time.Time { return now }
+
+func TestApply(t *testing.T) {
+	live := articleAfter(t)
+
+	tests := []struct {
+		name  string
+		event entity.Event
+		// change is applied to a copy of the live article to get the expected one.
+		change func(a *entity.Article)
+		// fails is set for events which cannot follow the creation of the article.
+		fails bool
+	}{
+		{
+			name:   "title changed",
+			event:  entity.ArticleTitleChanged{ArticleId: "a", Title: "renamed", At: now},
+			change: func(a *entity.Article) { a.Title, a.UpdatedAt = "renamed", now },
+		},
+		{
+			name:   "body edited",
+			event:  entity.ArticleBodyEdited{ArticleId: "a", Body: "edited", At: now},
+			change: func(a *entity.Article) { a.Body, a.UpdatedAt = "edited", now },
+		},
+		{
+			name:   "tags changed",
+			event:  entity.ArticleTagsChanged{ArticleId: "a", Tags: []string{"db"}, At: now},
+			change: func(a *entity.Article) { a.Tags, a.UpdatedAt = []string{"db"}, now },
+		},
+		{
+			name:   "published",
+			event:  entity.ArticlePublished{ArticleId: "a", At: now},
+			change: func(a *entity.Article) { a.PublishedAt = now },
+		},
+		{
+			name:   "deleted",
+			event:  entity.ArticleDeleted{ArticleId: "a", At: now},
+			change: func(a *entity.Article) { a.DeletedAt = now },
+		},
+		{
+			name:   "restored",
+			event:  entity.ArticleRestored{ArticleId: "a", At: now},
+			change: func(a *entity.Article) {},
+		},
+		{
+			name:  "purged",
+			event: entity.ArticlePurged{ArticleId: "a", At: now},
+			change: func(a *entity.Article) {
+				a.UserId, a.Title, a.Body, a.Tags = "", "", "", nil
+				a.Purged = true
+			},
+		},
+		{
+			name:  "created twice",
+			event: entity.ArticleCreated{ArticleId: "a", UserId: "user", Title: "title", At: now},
+			fails: true,
+		},
+		{
+			name:  "of another article",
+			event: entity.ArticleTitleChanged{ArticleId: "b", Title: "renamed", At: now},
+			fails: true,
+		},
+		{
+			name:  "unknown",
+			event: unknownEvent{},
+			fails: true,
+		},
+	}
+
+	for _, test := range tests {
+		article := live.Clone()
+		err := article.Apply(test.event)
+
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: event was applied: %+v", test.name, article)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: failed to apply, err: %v", test.name, err)
+			continue
+		}
+
+		want := live.Clone()
+		test.change(&want)
+		want.Version++
+		if !reflect.DeepEqual(article, want) {
+			t.Errorf("%s: unexpected article, got: %+v, want: %+v", test.name, article, want)
+		}
+		if len(article.Events()) != 0 {
+			t.Errorf("%s: applied event was recorded: %+v", test.name, article.Events())
+		}
+	}
+
+	// Only ArticleCreated can start an article.
+	var article entity.Article
+	if err := article.Apply(entity.ArticlePublished{ArticleId: "a", At: now}); err == nil {
+		t.Fatalf("Article was started by another event: %+v", article)
+	}
+
+	created := entity.ArticleCreated{ArticleId: "a", UserId: "user", Title: "title", Body: "body", Tags: []string{"go"}, At: createdAt}
+	if err := article.Apply(created); err != nil {
+		t.Fatalf("Failed to apply, err: %v", err)
+	}
+	want := entity.Article{Id: "a", UserId: "user", Title: "title", Body: "body", Tags: []string{"go"}, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt}
+	if !reflect.DeepEqual(article, want) {
+		t.Fatalf("Unexpected article, got: %+v, want: %+v", article, want)
+	}
+}
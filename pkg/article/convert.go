@@ -0,0 +1,105 @@
+package entity
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/grpc/pb"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ArticleFromPB converts the message without validating it.
+// Use NewArticle to create articles from client input.
+func ArticleFromPB(article *pb.Article) Article {
+	return Article{
+		Id:          article.GetId(),
+		UserId:      article.GetUserId(),
+		Title:       article.GetTitle(),
+		Body:        article.GetBody(),
+		Tags:        copyTags(article.GetTags()),
+		Version:     article.GetVersion(),
+		CreatedAt:   timeFromPB(article.GetCreatedAt()),
+		UpdatedAt:   timeFromPB(article.GetUpdatedAt()),
+		PublishedAt: timeFromPB(article.GetPublishedAt()),
+	}
+}
+
+// ArticleToPB converts the article leaving zero timestamps unset.
+func ArticleToPB(article Article) *pb.Article {
+	return &pb.Article{
+		Id:          article.Id,
+		UserId:      article.UserId,
+		Title:       article.Title,
+		Body:        article.Body,
+		Tags:        copyTags(article.Tags),
+		Version:     article.Version,
+		CreatedAt:   timeToPB(article.CreatedAt),
+		UpdatedAt:   timeToPB(article.UpdatedAt),
+		PublishedAt: timeToPB(article.PublishedAt),
+	}
+}
+
+func timeFromPB(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+func timeToPB(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// EventToPB converts the payload of a domain event. The article ID
+// and the time of the event are carried by pb.EventEnvelope.
+func EventToPB(event Event) (proto.Message, error) {
+	switch e := event.(type) {
+	case ArticleCreated:
+		return &pb.ArticleCreated{UserId: e.UserId, Title: e.Title, Body: e.Body, Tags: copyTags(e.Tags)}, nil
+	case ArticleTitleChanged:
+		return &pb.ArticleTitleChanged{Title: e.Title}, nil
+	case ArticleBodyEdited:
+		return &pb.ArticleBodyEdited{Body: e.Body}, nil
+	case ArticleTagsChanged:
+		return &pb.ArticleTagsChanged{Tags: copyTags(e.Tags)}, nil
+	case ArticlePublished:
+		return &pb.ArticlePublished{}, nil
+	case ArticleDeleted:
+		return &pb.ArticleDeleted{}, nil
+	case ArticleRestored:
+		return &pb.ArticleRestored{}, nil
+	case ArticlePurged:
+		return &pb.ArticlePurged{}, nil
+	default:
+		return nil, fmt.Errorf("unknown event %T", event)
+	}
+}
+
+// EventFromPB converts an event payload of the given article.
+func EventFromPB(articleId string, at time.Time, payload proto.Message) (Event, error) {
+	switch p := payload.(type) {
+	case *pb.ArticleCreated:
+		return ArticleCreated{ArticleId: articleId, UserId: p.GetUserId(), Title: p.GetTitle(), Body: p.GetBody(), Tags: copyTags(p.GetTags()), At: at}, nil
+	case *pb.ArticleTitleChanged:
+		return ArticleTitleChanged{ArticleId: articleId, Title: p.GetTitle(), At: at}, nil
+	case *pb.ArticleBodyEdited:
+		return ArticleBodyEdited{ArticleId: articleId, Body: p.GetBody(), At: at}, nil
+	case *pb.ArticleTagsChanged:
+		return ArticleTagsChanged{ArticleId: articleId, Tags: copyTags(p.GetTags()), At: at}, nil
+	case *pb.ArticlePublished:
+		return ArticlePublished{ArticleId: articleId, At: at}, nil
+	case *pb.ArticleDeleted:
+		return ArticleDeleted{ArticleId: articleId, At: at}, nil
+	case *pb.ArticleRestored:
+		return ArticleRestored{ArticleId: articleId, At: at}, nil
+	case *pb.ArticlePurged:
+		return ArticlePurged{ArticleId: articleId, At: at}, nil
+	default:
+		return nil, fmt.Errorf("unknown event payload %T", payload)
+	}
+}
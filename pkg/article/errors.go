@@ -0,0 +1,149 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Kind classifies domain errors independently of the transport
+// they are eventually reported through.
+type Kind uint8
+
+const (
+	KindUnknown Kind = iota
+	KindNotFound
+	KindAlreadyExists
+	KindInvalidArgument
+	KindPermissionDenied
+	KindConflict
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not found"
+	case KindAlreadyExists:
+		return "already exists"
+	case KindInvalidArgument:
+		return "invalid argument"
+	case KindPermissionDenied:
+		return "permission denied"
+	case KindConflict:
+		return "conflict"
+	default:
+		return "unknown"
+	}
+}
+
+// FieldViolation describes a single invalid field of a request.
+// Field is a dot-separated path, e.g. "article.title".
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// Error is returned by the domain and storage layers whenever
+// a failure should be reported to the client.
+type Error struct {
+	Kind Kind
+	// Reason is a short UPPER_SNAKE_CASE identifier of the failure.
+	Reason     string
+	Message    string
+	Violations []FieldViolation
+	Metadata   map[string]string
+}
+
+func (e *Error) Error() string {
+	if len(e.Violations) == 0 {
+		return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+	}
+
+	violations := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		violations = append(violations, v.Field+": "+v.Description)
+	}
+	return fmt.Sprintf("%s: %s [%s]", e.Kind, e.Message, strings.Join(violations, "; "))
+}
+
+// Is reports whether target is an *Error of the same Kind,
+// which lets callers use errors.Is(err, entity.ErrNotFound).
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return t.Kind == e.Kind && (t.Reason == "" || t.Reason == e.Reason)
+}
+
+// Sentinels meant to be used with errors.Is.
+var (
+	ErrNotFound         = &Error{Kind: KindNotFound}
+	ErrAlreadyExists    = &Error{Kind: KindAlreadyExists}
+	ErrInvalidArgument  = &Error{Kind: KindInvalidArgument}
+	ErrPermissionDenied = &Error{Kind: KindPermissionDenied}
+	ErrConflict         = &Error{Kind: KindConflict}
+)
+
+// KindOf returns the Kind of the first *Error in err's chain.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindUnknown
+}
+
+// Violations returns the field violations of the first *Error in err's chain.
+func Violations(err error) []FieldViolation {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Violations
+	}
+	return nil
+}
+
+func NotFound(id string) error {
+	return &Error{
+		Kind:     KindNotFound,
+		Reason:   "ARTICLE_NOT_FOUND",
+		Message:  fmt.Sprintf("article %q not found", id),
+		Metadata: map[string]string{"article_id": id},
+	}
+}
+
+func AlreadyExists(id string) error {
+	return &Error{
+		Kind:     KindAlreadyExists,
+		Reason:   "ARTICLE_ALREADY_EXISTS",
+		Message:  fmt.Sprintf("article %q already exists", id),
+		Metadata: map[string]string{"article_id": id},
+	}
+}
+
+// InvalidArgument returns an error listing every given violation.
+func InvalidArgument(violations ...FieldViolation) error {
+	return &Error{
+		Kind:       KindInvalidArgument,
+		Reason:     "INVALID_ARGUMENT",
+		Message:    "request contains invalid fields",
+		Violations: violations,
+	}
+}
+
+func PermissionDenied(reason, msg string) error {
+	return &Error{
+		Kind:    KindPermissionDenied,
+		Reason:  reason,
+		Message: msg,
+	}
+}
+
+func Conflict(reason, msg string, metadata map[string]string) error {
+	return &Error{
+		Kind:     KindConflict,
+		Reason:   reason,
+		Message:  msg,
+		Metadata: metadata,
+	}
+}
@@ -0,0 +1,81 @@
+package entity
+
+import "time"
+
+// Event is a fact about a change of an article.
+// Events are recorded by the methods of Article.
+type Event interface {
+	AggregateId() string
+	OccurredAt() time.Time
+}
+
+type ArticleCreated struct {
+	ArticleId string
+	UserId    string
+	Title     string
+	Body      string
+	Tags      []string
+	At        time.Time
+}
+
+func (e ArticleCreated) AggregateId() string   { return e.ArticleId }
+func (e ArticleCreated) OccurredAt() time.Time { return e.At }
+
+type ArticleTitleChanged struct {
+	ArticleId string
+	Title     string
+	At        time.Time
+}
+
+func (e ArticleTitleChanged) AggregateId() string   { return e.ArticleId }
+func (e ArticleTitleChanged) OccurredAt() time.Time { return e.At }
+
+type ArticleBodyEdited struct {
+	ArticleId string
+	Body      string
+	At        time.Time
+}
+
+func (e ArticleBodyEdited) AggregateId() string   { return e.ArticleId }
+func (e ArticleBodyEdited) OccurredAt() time.Time { return e.At }
+
+type ArticleTagsChanged struct {
+	ArticleId string
+	Tags      []string
+	At        time.Time
+}
+
+func (e ArticleTagsChanged) AggregateId() string   { return e.ArticleId }
+func (e ArticleTagsChanged) OccurredAt() time.Time { return e.At }
+
+type ArticlePublished struct {
+	ArticleId string
+	At        time.Time
+}
+
+func (e ArticlePublished) AggregateId() string   { return e.ArticleId }
+func (e ArticlePublished) OccurredAt() time.Time { return e.At }
+
+type ArticleDeleted struct {
+	ArticleId string
+	At        time.Time
+}
+
+func (e ArticleDeleted) AggregateId() string   { return e.ArticleId }
+func (e ArticleDeleted) OccurredAt() time.Time { return e.At }
+
+type ArticleRestored struct {
+	ArticleId string
+	At        time.Time
+}
+
+func (e ArticleRestored) AggregateId() string   { return e.ArticleId }
+func (e ArticleRestored) OccurredAt() time.Time { return e.At }
+
+type ArticlePurged struct {
+	ArticleId string
+	At        time.Time
+}
+
+func (e ArticlePurged) AggregateId() string   { return e.ArticleId }
+func (e ArticlePurged) OccurredAt() time.Time { return e.At }
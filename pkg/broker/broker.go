@@ -0,0 +1,41 @@
+// Package broker publishes and consumes events shared
+// with other dev-forum services.
+package broker
+
+import (
+	"context"
+	"strings"
+)
+
+// Message is a single event published to a topic.
+type Message struct {
+	// Id lets consumers discard messages delivered more than once.
+	Id    string
+	Topic string
+	Type  string
+	Data  []byte
+}
+
+// Handler processes a delivered message. A returned error
+// asks the broker to deliver the message again.
+type Handler func(ctx context.Context, msg Message) error
+
+type Broker interface {
+	Publish(ctx context.Context, msg Message) error
+	// Subscribe starts delivering messages published to the topic
+	// after it returns, until ctx is cancelled.
+	Subscribe(ctx context.Context, topic string, handler Handler) error
+	Close() error
+}
+
+// Topic returns the topic of the events of an aggregate type
+// in a project, e.g. "dev-forum.article".
+func Topic(projectName, aggregateType string) string {
+	return token(projectName) + "." + token(aggregateType)
+}
+
+// token replaces characters which separate or match
+// parts of a topic.
+func token(s string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_").Replace(s)
+}
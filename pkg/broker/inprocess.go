@@ -0,0 +1,71 @@
+package broker
+
+import (
+	"context"
+	"sync"
+)
+
+// InProcess delivers messages to subscribers in the same process.
+// Publish calls the handlers of the topic synchronously and fails
+// with the first error they return, after calling all of them.
+type InProcess struct {
+	mu          sync.RWMutex
+	nextId      int
+	subscribers map[string]map[int]Handler
+}
+
+func NewInProcess() *InProcess {
+	return &InProcess{
+		subscribers: make(map[string]map[int]Handler),
+	}
+}
+
+func (b *InProcess) Publish(ctx context.Context, msg Message) error {
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.subscribers[msg.Topic]))
+	for _, handler := range b.subscribers[msg.Topic] {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	var err error
+	for _, handler := range handlers {
+		msg := msg
+		msg.Data = append([]byte(nil), msg.Data...)
+		if handlerErr := handler(ctx, msg); handlerErr != nil && err == nil {
+			err = handlerErr
+		}
+	}
+	return err
+}
+
+func (b *InProcess) Subscribe(ctx context.Context, topic string, handler Handler) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextId
+	b.nextId++
+
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = make(map[int]Handler)
+	}
+	b.subscribers[topic][id] = handler
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.subscribers[topic], id)
+		if len(b.subscribers[topic]) == 0 {
+			delete(b.subscribers, topic)
+		}
+	}()
+
+	return nil
+}
+
+func (b *InProcess) Close() error {
+	return nil
+}
@@ -0,0 +1,41 @@
+package broker_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/krixlion/dev-forum_article/pkg/broker"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+)
+
+func TestInProcessDeliversToSubscribers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := broker.NewInProcess()
+	topic := broker.Topic("dev-forum", "article")
+
+	received := make(chan broker.Message, 2)
+	if err := b.Subscribe(ctx, topic, func(_ context.Context, msg broker.Message) error {
+		received <- msg
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to subscribe, err: %v", err)
+	}
+
+	publisher := broker.NewPublisher(b, topic)
+	if err := publisher.Publish(ctx, cmd.Event{Id: "event", Type: "created", Data: []byte("data")}); err != nil {
+		t.Fatalf("Failed to publish, err: %v", err)
+	}
+	if err := b.Publish(ctx, broker.Message{Topic: broker.Topic("dev-forum", "comment")}); err != nil {
+		t.Fatalf("Failed to publish, err: %v", err)
+	}
+
+	msg := <-received
+	if msg.Id != "event" || msg.Topic != "dev-forum.article" || msg.Type != "created" || string(msg.Data) != "data" {
+		t.Fatalf("Unexpected message: %+v", msg)
+	}
+	if len(received) != 0 {
+		t.Fatalf("Message of another topic was delivered: %+v", <-received)
+	}
+}
@@ -0,0 +1,150 @@
+package broker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/log"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// TypeHeader carries Message.Type of messages published to NATS.
+const TypeHeader = "Event-Type"
+
+// NATS is a Broker on top of NATS JetStream. Every topic is kept
+// in its own stream, which is created on first use. JetStream
+// drops messages republished with the same Id within
+// the duplicate window of the stream.
+type NATS struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream
+	durable string
+	mu      sync.Mutex
+	// streams holds topics whose streams are known to exist.
+	streams map[string]bool
+}
+
+type NATSOption func(*NATS)
+
+// WithDurable makes subscriptions share a durable consumer of the given
+// name, which keeps its position across restarts and spreads messages
+// among replicas. Without it every subscription only gets
+// the messages published after it started.
+func WithDurable(name string) NATSOption {
+	return func(b *NATS) {
+		b.durable = name
+	}
+}
+
+// NewNATS takes ownership of conn, which is closed by Close.
+func NewNATS(conn *nats.Conn, opts ...NATSOption) (*NATS, error) {
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &NATS{
+		conn:    conn,
+		js:      js,
+		streams: make(map[string]bool),
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b, nil
+}
+
+// streamName returns the name of the stream of a topic,
+// which cannot contain dots.
+func streamName(topic string) string {
+	return token(topic)
+}
+
+func (b *NATS) ensureStream(ctx context.Context, topic string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.streams[topic] {
+		return nil
+	}
+
+	_, err := b.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     streamName(topic),
+		Subjects: []string{topic},
+	})
+	if err != nil {
+		return err
+	}
+
+	b.streams[topic] = true
+	return nil
+}
+
+func (b *NATS) Publish(ctx context.Context, msg Message) error {
+	if err := b.ensureStream(ctx, msg.Topic); err != nil {
+		return err
+	}
+
+	m := nats.NewMsg(msg.Topic)
+	m.Data = msg.Data
+	m.Header.Set(TypeHeader, msg.Type)
+
+	_, err := b.js.PublishMsg(ctx, m, jetstream.WithMsgID(msg.Id))
+	return err
+}
+
+func (b *NATS) Subscribe(ctx context.Context, topic string, handler Handler) error {
+	if err := b.ensureStream(ctx, topic); err != nil {
+		return err
+	}
+
+	config := jetstream.ConsumerConfig{
+		Durable:       b.durable,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		FilterSubject: topic,
+	}
+	if b.durable == "" {
+		config.DeliverPolicy = jetstream.DeliverNewPolicy
+		config.InactiveThreshold = time.Minute
+	}
+
+	consumer, err := b.js.CreateOrUpdateConsumer(ctx, streamName(topic), config)
+	if err != nil {
+		return err
+	}
+
+	consumeCtx, err := consumer.Consume(func(m jetstream.Msg) {
+		msg := Message{
+			Id:    m.Headers().Get(jetstream.MsgIDHeader),
+			Topic: m.Subject(),
+			Type:  m.Headers().Get(TypeHeader),
+			Data:  m.Data(),
+		}
+
+		if err := handler(ctx, msg); err != nil {
+			log.PrintLn("msg", "failed to handle a message", "topic", topic, "id", msg.Id, "err", err)
+			m.Nak()
+			return
+		}
+		m.Ack()
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		consumeCtx.Stop()
+	}()
+
+	return nil
+}
+
+func (b *NATS) Close() error {
+	return b.conn.Drain()
+}
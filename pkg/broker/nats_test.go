@@ -0,0 +1,86 @@
+package broker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/broker"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// connect starts a JetStream server in the process and connects to it.
+func connect(t *testing.T) *nats.Conn {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create NATS server, err: %v", err)
+	}
+
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+	t.Cleanup(srv.Shutdown)
+
+	conn, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect, err: %v", err)
+	}
+	t.Cleanup(conn.Close)
+
+	return conn
+}
+
+func TestNATSDeduplicatesMessages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	b, err := broker.NewNATS(connect(t), broker.WithDurable("test"))
+	if err != nil {
+		t.Fatalf("Failed to create broker, err: %v", err)
+	}
+	defer b.Close()
+
+	topic := broker.Topic("dev-forum", "article")
+
+	received := make(chan broker.Message, 3)
+	if err := b.Subscribe(ctx, topic, func(_ context.Context, msg broker.Message) error {
+		received <- msg
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to subscribe, err: %v", err)
+	}
+
+	for _, id := range []string{"1", "1", "2"} {
+		msg := broker.Message{Id: id, Topic: topic, Type: "created", Data: []byte(id)}
+		if err := b.Publish(ctx, msg); err != nil {
+			t.Fatalf("Failed to publish, err: %v", err)
+		}
+	}
+
+	for _, want := range []string{"1", "2"} {
+		select {
+		case msg := <-received:
+			if msg.Id != want || msg.Type != "created" || string(msg.Data) != want {
+				t.Fatalf("Unexpected message: %+v, want id: %v", msg, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Message %v was not delivered", want)
+		}
+	}
+
+	select {
+	case msg := <-received:
+		t.Fatalf("Duplicate was delivered: %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
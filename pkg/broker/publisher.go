@@ -0,0 +1,29 @@
+package broker
+
+import (
+	"context"
+
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+)
+
+// Publisher is a cmd.Publisher sending events to a single topic.
+type Publisher struct {
+	broker Broker
+	topic  string
+}
+
+func NewPublisher(broker Broker, topic string) Publisher {
+	return Publisher{
+		broker: broker,
+		topic:  topic,
+	}
+}
+
+func (p Publisher) Publish(ctx context.Context, event cmd.Event) error {
+	return p.broker.Publish(ctx, Message{
+		Id:    event.Id,
+		Topic: p.topic,
+		Type:  event.Type,
+		Data:  event.Data,
+	})
+}
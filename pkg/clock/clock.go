@@ -0,0 +1,43 @@
+// Package clock provides sources of the current time.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock returns the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// System reads the time from the operating system.
+type System struct{}
+
+func (System) Now() time.Time {
+	return time.Now()
+}
+
+// Stepping is a deterministic Clock meant for tests.
+// It starts at the given time and advances by step on every call.
+type Stepping struct {
+	mu   sync.Mutex
+	next time.Time
+	step time.Duration
+}
+
+func NewStepping(start time.Time, step time.Duration) *Stepping {
+	return &Stepping{
+		next: start,
+		step: step,
+	}
+}
+
+func (c *Stepping) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.next
+	c.next = c.next.Add(c.step)
+	return now
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/grpc/pb"
+	"github.com/krixlion/dev-forum_article/pkg/idgen"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// EventSchemaVersion is the version of the event payloads written by the service.
+const EventSchemaVersion = 2
+
+// DefaultAggregateType is used when AGGREGATE_ID is not set.
+const DefaultAggregateType = "article"
+
+// EventMetadata ties events to the request which caused them.
+type EventMetadata struct {
+	CorrelationId string
+	CausationId   string
+}
+
+// EventCodec wraps domain events in pb.EventEnvelope
+// and stores the envelopes in Event.Data.
+type EventCodec struct {
+	aggregateType string
+	ids           idgen.IDGenerator
+	upcasters     *Upcasters
+}
+
+type CodecOption func(*EventCodec)
+
+// WithUpcasters replaces DefaultUpcasters used to decode
+// events written at older schema versions.
+func WithUpcasters(upcasters *Upcasters) CodecOption {
+	return func(c *EventCodec) {
+		c.upcasters = upcasters
+	}
+}
+
+func NewEventCodec(aggregateType string, ids idgen.IDGenerator, opts ...CodecOption) EventCodec {
+	c := EventCodec{
+		aggregateType: aggregateType,
+		ids:           ids,
+		upcasters:     DefaultUpcasters(),
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return c
+}
+
+// Encode returns the record of an event at the given sequence of its stream.
+func (c EventCodec) Encode(sequence int64, event entity.Event, meta EventMetadata) (Event, error) {
+	payload, err := entity.EventToPB(event)
+	if err != nil {
+		return Event{}, err
+	}
+
+	packed, err := anypb.New(payload)
+	if err != nil {
+		return Event{}, err
+	}
+
+	envelope := &pb.EventEnvelope{
+		EventId:       c.ids.NewID(),
+		AggregateType: c.aggregateType,
+		AggregateId:   event.AggregateId(),
+		Sequence:      sequence,
+		Timestamp:     timestamppb.New(event.OccurredAt()),
+		SchemaVersion: EventSchemaVersion,
+		CorrelationId: meta.CorrelationId,
+		CausationId:   meta.CausationId,
+		Payload:       packed,
+	}
+
+	data, err := proto.Marshal(envelope)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		Id:          envelope.EventId,
+		AggregateId: event.AggregateId(),
+		Type:        string(payload.ProtoReflect().Descriptor().FullName()),
+		Data:        data,
+	}, nil
+}
+
+// Scrub returns the data of the event with the payload emptied.
+// The envelope is kept as it was, so the event still decodes
+// into its type, with the fields of the payload at their zero values.
+func (c EventCodec) Scrub(event Event) ([]byte, error) {
+	envelope := &pb.EventEnvelope{}
+	if err := proto.Unmarshal(event.Data, envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode event %d of %q: %w", event.Version, event.AggregateId, err)
+	}
+
+	if envelope.GetPayload() != nil {
+		envelope.Payload.Value = nil
+	}
+
+	return proto.Marshal(envelope)
+}
+
+// Decode unwraps the domain event along with its envelope.
+// Events written at older schema versions are upcasted first.
+func (c EventCodec) Decode(event Event) (entity.Event, *pb.EventEnvelope, error) {
+	envelope := &pb.EventEnvelope{}
+	if err := proto.Unmarshal(event.Data, envelope); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode event %d of %q: %w", event.Version, event.AggregateId, err)
+	}
+
+	if envelope.GetSchemaVersion() > EventSchemaVersion {
+		return nil, nil, fmt.Errorf("event %q has unsupported schema version %d", envelope.GetEventId(), envelope.GetSchemaVersion())
+	}
+
+	if err := c.upcasters.Upcast(envelope, EventSchemaVersion); err != nil {
+		return nil, nil, err
+	}
+
+	payload, err := envelope.GetPayload().UnmarshalNew()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode payload of event %q: %w", envelope.GetEventId(), err)
+	}
+
+	domainEvent, err := entity.EventFromPB(envelope.GetAggregateId(), envelope.GetTimestamp().AsTime(), payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return domainEvent, envelope, nil
+}
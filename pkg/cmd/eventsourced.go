@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+)
+
+// maxSaveAttempts bounds how many times a change racing
+// with other writers of the same article is retried.
+const maxSaveAttempts = 3
+
+// TombstoneFinder lists IDs of articles deleted before the given time.
+// It is usually backed by the read model, so the latest deletions may
+// be missing until they are projected.
+type TombstoneFinder interface {
+	Tombstones(ctx context.Context, deletedBefore time.Time) ([]string, error)
+}
+
+// EventSourcedStorage implements Storage by keeping every article
+// as a stream of events in an EventStore.
+type EventSourcedStorage struct {
+	repo       Repository
+	tombstones TombstoneFinder
+	clock      clock.Clock
+	// onAppend is called with every batch of appended events.
+	onAppend func([]Event)
+}
+
+type StorageOption func(*EventSourcedStorage)
+
+// WithClock sets the source of deletion, restoration and purge times.
+func WithClock(clock clock.Clock) StorageOption {
+	return func(s *EventSourcedStorage) {
+		s.clock = clock
+	}
+}
+
+// WithAppendHook sets a function called after events are appended,
+// e.g. to wake up projections.
+func WithAppendHook(hook func([]Event)) StorageOption {
+	return func(s *EventSourcedStorage) {
+		s.onAppend = hook
+	}
+}
+
+func NewEventSourcedStorage(repo Repository, tombstones TombstoneFinder, opts ...StorageOption) *EventSourcedStorage {
+	s := &EventSourcedStorage{
+		repo:       repo,
+		tombstones: tombstones,
+		clock:      clock.System{},
+		onAppend:   func([]Event) {},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Create saves events recorded by a new article.
+func (s *EventSourcedStorage) Create(ctx context.Context, article entity.Article) (entity.Article, error) {
+	article = article.Clone()
+
+	// Streams of purged articles are kept, so their IDs stay reserved.
+	if err := s.save(ctx, &article); err != nil {
+		if errors.Is(err, ErrConcurrentModification) {
+			return entity.Article{}, entity.AlreadyExists(article.Id)
+		}
+		return entity.Article{}, err
+	}
+
+	return article, nil
+}
+
+func (s *EventSourcedStorage) Update(ctx context.Context, id string, mutate MutateFunc) (entity.Article, error) {
+	return s.modify(ctx, id, func(article *entity.Article) error {
+		if article.IsDeleted() {
+			return entity.NotFound(id)
+		}
+		return mutate(article)
+	})
+}
+
+func (s *EventSourcedStorage) Delete(ctx context.Context, id string) (entity.Article, error) {
+	return s.modify(ctx, id, func(article *entity.Article) error {
+		return article.Delete(s.clock.Now())
+	})
+}
+
+func (s *EventSourcedStorage) Restore(ctx context.Context, id string, deletedAfter time.Time) (entity.Article, error) {
+	return s.modify(ctx, id, func(article *entity.Article) error {
+		if article.IsDeleted() && !article.DeletedAt.After(deletedAfter) {
+			return entity.NotFound(id)
+		}
+		return article.Restore(s.clock.Now())
+	})
+}
+
+// Purge erases tombstones reported by the TombstoneFinder which are
+// still deleted and were deleted before deletedBefore. The payloads of
+// their events are scrubbed as ArticlePurged is recorded, see Repository.Save.
+func (s *EventSourcedStorage) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	ids, err := s.tombstones.Tombstones(ctx, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		_, err := s.modify(ctx, id, func(article *entity.Article) error {
+			if !article.IsDeleted() || !article.DeletedAt.Before(deletedBefore) {
+				return nil
+			}
+			return article.Purge(s.clock.Now())
+		})
+		if errors.Is(err, entity.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (s *EventSourcedStorage) Close() error {
+	return s.repo.Close()
+}
+
+// modify loads the article, applies change and saves the recorded events.
+// The whole cycle is retried if another writer changed the article
+// in the meantime. Purged articles are reported as not found.
+func (s *EventSourcedStorage) modify(ctx context.Context, id string, change func(*entity.Article) error) (entity.Article, error) {
+	for attempt := 1; ; attempt++ {
+		article, err := s.repo.Load(ctx, id)
+		if err != nil {
+			return entity.Article{}, err
+		}
+
+		if article.Purged {
+			return entity.Article{}, entity.NotFound(id)
+		}
+
+		if err := change(&article); err != nil {
+			return entity.Article{}, err
+		}
+
+		err = s.save(ctx, &article)
+		if errors.Is(err, ErrConcurrentModification) && attempt < maxSaveAttempts {
+			continue
+		}
+		if err != nil {
+			return entity.Article{}, err
+		}
+
+		return article, nil
+	}
+}
+
+func (s *EventSourcedStorage) save(ctx context.Context, article *entity.Article) error {
+	appended, err := s.repo.Save(ctx, article, EventMetadataFromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	if len(appended) > 0 {
+		recordAppend(ctx, appended)
+		s.onAppend(appended)
+	}
+	return nil
+}
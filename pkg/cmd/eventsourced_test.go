@@ -0,0 +1,86 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/idgen"
+	"github.com/krixlion/dev-forum_article/pkg/memory"
+)
+
+// tombstones is a TombstoneFinder which reports the same IDs every time.
+type tombstones []string
+
+func (t tombstones) Tombstones(context.Context, time.Time) ([]string, error) {
+	return t, nil
+}
+
+func TestPurgeScrubsEvents(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	events := memory.NewEventStore(clock.System{})
+	snapshots := memory.NewSnapshots()
+	repo := cmd.NewRepository(events,
+		cmd.NewEventCodec(cmd.DefaultAggregateType, idgen.NewSequenceGenerator("event-")),
+		cmd.WithSnapshots(snapshots, cmd.SnapshotPolicy{Every: 1}),
+	)
+	storage := cmd.NewEventSourcedStorage(repo, tombstones{"article"}, cmd.WithClock(clock.NewStepping(now, time.Minute)))
+
+	article, err := entity.NewArticle("article", "secret user", "secret title", "secret body", []string{"secret"}, now)
+	if err != nil {
+		t.Fatalf("Failed to create article, err: %v", err)
+	}
+	if _, err := storage.Create(ctx, article); err != nil {
+		t.Fatalf("Failed to save article, err: %v", err)
+	}
+	if _, err := storage.Update(ctx, "article", func(a *entity.Article) error {
+		return a.EditBody("secret edit", now)
+	}); err != nil {
+		t.Fatalf("Failed to update article, err: %v", err)
+	}
+	if _, err := storage.Delete(ctx, "article"); err != nil {
+		t.Fatalf("Failed to delete article, err: %v", err)
+	}
+
+	if snapshot, ok, _ := snapshots.Latest(ctx, "article"); !ok || !bytes.Contains(snapshot.Data, []byte("secret")) {
+		t.Fatalf("Snapshot of the article was not taken: %+v", snapshot)
+	}
+
+	purged, err := storage.Purge(ctx, now.Add(time.Hour))
+	if err != nil || purged != 1 {
+		t.Fatalf("Article was not purged, purged: %v, err: %v", purged, err)
+	}
+
+	records, err := events.Load(ctx, "article", 1)
+	if err != nil {
+		t.Fatalf("Failed to load events, err: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Unexpected number of events: %v", len(records))
+	}
+	for _, record := range records {
+		if bytes.Contains(record.Data, []byte("secret")) {
+			t.Fatalf("Event %d was not scrubbed: %q", record.Version, record.Data)
+		}
+	}
+
+	snapshot, _, err := snapshots.Latest(ctx, "article")
+	if err != nil || bytes.Contains(snapshot.Data, []byte("secret")) {
+		t.Fatalf("Snapshot was not scrubbed: %s, err: %v", snapshot.Data, err)
+	}
+
+	// Scrubbed events still replay into the purged article.
+	got, err := cmd.NewRepository(events, cmd.NewEventCodec(cmd.DefaultAggregateType, idgen.NewSequenceGenerator("event-"))).Load(ctx, "article")
+	if err != nil {
+		t.Fatalf("Failed to load article, err: %v", err)
+	}
+	if !got.Purged || got.Title != "" || got.Body != "" || got.UserId != "" || got.Version != 4 {
+		t.Fatalf("Unexpected article: %+v", got)
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+)
+
+// Event is a serialized domain event as kept by an EventStore.
+type Event struct {
+	// Id is unique across all events. Consumers use it
+	// to discard events which are delivered more than once.
+	Id          string
+	AggregateId string
+	// Version is the position of the event in the stream of its
+	// aggregate. The first event of every aggregate is at version 1.
+	// It is assigned by the store.
+	Version int64
+	// Position orders events of all aggregates.
+	// It starts at 1 and is assigned by the store.
+	Position   int64
+	Type       string
+	Data       []byte
+	RecordedAt time.Time
+}
+
+// EventStore is the append-only log of the command side.
+// Events of a single aggregate form a stream ordered by Version.
+type EventStore interface {
+	// Append atomically adds events to the end of the aggregate's stream,
+	// which must be at expectedVersion, 0 meaning the stream must not exist.
+	// Otherwise it fails with an error matching entity.ErrConflict and
+	// nothing is appended. It returns the events with their versions
+	// and positions assigned.
+	Append(ctx context.Context, aggregateId string, expectedVersion int64, events []Event) ([]Event, error)
+	// Load returns events of the aggregate starting at fromVersion.
+	// It returns no events for an unknown aggregate.
+	Load(ctx context.Context, aggregateId string, fromVersion int64) ([]Event, error)
+	// ReadAll returns at most limit events of all aggregates
+	// with positions greater than afterPosition, in position order.
+	ReadAll(ctx context.Context, afterPosition int64, limit int) ([]Event, error)
+	// Head returns the position of the last appended event, 0 if there is none.
+	Head(ctx context.Context) (int64, error)
+	// AppendAndScrub appends events like Append and in the same write
+	// replaces the data of earlier events of the aggregate at the versions
+	// given as keys, so either both happen or neither does. It is the only
+	// change made to appended events, meant to erase the content of purged
+	// articles as their purge is recorded. The new data must not be longer
+	// than the data it replaces.
+	AppendAndScrub(ctx context.Context, aggregateId string, expectedVersion int64, events []Event, data map[int64][]byte) ([]Event, error)
+	Close() error
+}
+
+// ErrConcurrentModification matches errors returned by ConcurrencyConflict.
+var ErrConcurrentModification = &entity.Error{Kind: entity.KindConflict, Reason: "CONCURRENT_MODIFICATION"}
+
+// ConcurrencyConflict is returned by EventStore.Append
+// when the stream is not at the expected version.
+func ConcurrencyConflict(aggregateId string, expected, actual int64) error {
+	return entity.Conflict(
+		"CONCURRENT_MODIFICATION",
+		fmt.Sprintf("stream %q is at version %d, expected %d", aggregateId, actual, expected),
+		map[string]string{
+			"aggregate_id":     aggregateId,
+			"expected_version": strconv.FormatInt(expected, 10),
+			"actual_version":   strconv.FormatInt(actual, 10),
+		},
+	)
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+)
+
+// AsOf selects a past state of an article. Zero fields select the latest state.
+type AsOf struct {
+	// Time selects the state after the last event which occurred at or before it.
+	Time time.Time
+	// Version selects the state after the event at this version.
+	Version int64
+}
+
+func (a AsOf) includes(event entity.Event, version int64) bool {
+	if a.Version > 0 && version > a.Version {
+		return false
+	}
+	if !a.Time.IsZero() && event.OccurredAt().After(a.Time) {
+		return false
+	}
+	return true
+}
+
+// History rebuilds past states of articles from their events.
+type History interface {
+	// LoadAsOf fails with NotFound if the article did not exist
+	// at that point, was deleted at that point or has been purged since.
+	LoadAsOf(ctx context.Context, id string, asOf AsOf) (entity.Article, error)
+}
+
+// LoadAsOf replays the whole stream of the article, skipping snapshots,
+// since the latest state is needed to tell whether it has been purged.
+func (r Repository) LoadAsOf(ctx context.Context, id string, asOf AsOf) (entity.Article, error) {
+	records, err := r.store.Load(ctx, id, 1)
+	if err != nil {
+		return entity.Article{}, err
+	}
+
+	var past, latest entity.Article
+	for _, record := range records {
+		event, _, err := r.codec.Decode(record)
+		if err != nil {
+			return entity.Article{}, err
+		}
+		if err := latest.Apply(event); err != nil {
+			return entity.Article{}, err
+		}
+		if asOf.includes(event, record.Version) {
+			past = latest.Clone()
+		}
+	}
+
+	if latest.Purged || past.Version == 0 || past.IsDeleted() {
+		return entity.Article{}, entity.NotFound(id)
+	}
+
+	past.ClearEvents()
+	return past, nil
+}
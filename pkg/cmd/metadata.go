@@ -0,0 +1,17 @@
+package cmd
+
+import "context"
+
+type metadataKey struct{}
+
+// ContextWithEventMetadata returns a context carrying the metadata
+// of events saved on behalf of the request.
+func ContextWithEventMetadata(ctx context.Context, meta EventMetadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, meta)
+}
+
+// EventMetadataFromContext returns metadata set by ContextWithEventMetadata.
+func EventMetadataFromContext(ctx context.Context) EventMetadata {
+	meta, _ := ctx.Value(metadataKey{}).(EventMetadata)
+	return meta
+}
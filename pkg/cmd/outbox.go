@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/log"
+)
+
+const (
+	DefaultRelayBatchSize    = 100
+	DefaultRelayPollInterval = time.Second
+	DefaultRelayBackoff      = time.Second
+)
+
+// Outbox is implemented by event stores which queue appended events
+// for publishing in the same atomic write that appends them,
+// so that an event is never stored without being published or
+// published without being stored.
+type Outbox interface {
+	// Unsent returns at most limit events which were not marked as sent,
+	// in position order.
+	Unsent(ctx context.Context, limit int) ([]Event, error)
+	// MarkSent marks every event up to and including position as sent.
+	MarkSent(ctx context.Context, position int64) error
+}
+
+// Publisher delivers events to other services.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// Relay publishes events from an Outbox in position order.
+// An event is marked as sent only after it has been published,
+// so it may be published again after a failure or a restart.
+// Consumers should discard repeats by Event.Id.
+type Relay struct {
+	outbox       Outbox
+	publisher    Publisher
+	batchSize    int
+	pollInterval time.Duration
+	backoff      time.Duration
+	wake         chan struct{}
+}
+
+type RelayOption func(*Relay)
+
+// WithRelayBatchSize sets how many events are read from the outbox at once.
+func WithRelayBatchSize(size int) RelayOption {
+	return func(r *Relay) {
+		r.batchSize = size
+	}
+}
+
+// WithRelayPollInterval sets how often the outbox is checked
+// for unsent events when the Relay is not woken up.
+func WithRelayPollInterval(interval time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.pollInterval = interval
+	}
+}
+
+// WithRelayBackoff sets how long the Relay waits after a failed publish.
+func WithRelayBackoff(backoff time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.backoff = backoff
+	}
+}
+
+func NewRelay(outbox Outbox, publisher Publisher, opts ...RelayOption) *Relay {
+	r := &Relay{
+		outbox:       outbox,
+		publisher:    publisher,
+		batchSize:    DefaultRelayBatchSize,
+		pollInterval: DefaultRelayPollInterval,
+		backoff:      DefaultRelayBackoff,
+		wake:         make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Wake makes the Relay check the outbox without waiting
+// for the poll interval. It never blocks.
+func (r *Relay) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes events until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		wait := (<-chan time.Time)(ticker.C)
+		if err := r.flush(ctx); err != nil && ctx.Err() == nil {
+			log.PrintLn("msg", "failed to relay events", "err", err)
+			wait = time.After(r.backoff)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.wake:
+		case <-wait:
+		}
+	}
+}
+
+// flush publishes unsent events until the outbox is empty.
+func (r *Relay) flush(ctx context.Context) error {
+	for {
+		events, err := r.outbox.Unsent(ctx, r.batchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(events) == 0 {
+			return nil
+		}
+
+		for i, event := range events {
+			if err := r.publisher.Publish(ctx, event); err != nil {
+				// Keep the progress made so far, so that only
+				// the failed event and the ones after it are retried.
+				if i > 0 {
+					if markErr := r.outbox.MarkSent(ctx, events[i-1].Position); markErr != nil {
+						return markErr
+					}
+				}
+				return err
+			}
+		}
+
+		if err := r.outbox.MarkSent(ctx, events[len(events)-1].Position); err != nil {
+			return err
+		}
+	}
+}
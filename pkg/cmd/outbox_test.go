@@ -0,0 +1,79 @@
+package cmd_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/memory"
+)
+
+// flakyPublisher fails the first publish of every event.
+type flakyPublisher struct {
+	mu        sync.Mutex
+	attempts  map[string]int
+	published []string
+}
+
+func (p *flakyPublisher) Publish(_ context.Context, event cmd.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.attempts[event.Id]++
+	if p.attempts[event.Id] == 1 {
+		return errors.New("broker unavailable")
+	}
+
+	p.published = append(p.published, event.Id)
+	return nil
+}
+
+func TestRelayRetriesUntilPublished(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events := memory.NewEventStore(clock.System{})
+	for i, id := range []string{"a", "b", "c"} {
+		if _, err := events.Append(ctx, "article", int64(i), []cmd.Event{{Id: id, Type: "x"}}); err != nil {
+			t.Fatalf("Failed to append, err: %v", err)
+		}
+	}
+
+	publisher := &flakyPublisher{attempts: make(map[string]int)}
+	relay := cmd.NewRelay(events, publisher,
+		cmd.WithRelayPollInterval(time.Millisecond),
+		cmd.WithRelayBackoff(time.Millisecond),
+	)
+	go relay.Run(ctx)
+
+	for {
+		unsent, err := events.Unsent(ctx, 10)
+		if err != nil {
+			t.Fatalf("Failed to read the outbox, err: %v", err)
+		}
+		if len(unsent) == 0 {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("Outbox was not drained, unsent: %+v", unsent)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+
+	want := []string{"a", "b", "c"}
+	if len(publisher.published) != len(want) {
+		t.Fatalf("Unexpected published events, got: %v, want: %v", publisher.published, want)
+	}
+	for i := range want {
+		if publisher.published[i] != want[i] {
+			t.Fatalf("Events were published out of order, got: %v, want: %v", publisher.published, want)
+		}
+	}
+}
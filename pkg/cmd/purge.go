@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/log"
+)
+
+// RunPurger removes tombstones older than retention every interval.
+// It blocks until ctx is cancelled.
+func RunPurger(ctx context.Context, storage Storage, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := storage.Purge(ctx, now.Add(-retention))
+			if err != nil {
+				log.PrintLn("msg", "failed to purge tombstones", "err", err)
+				continue
+			}
+			if purged > 0 {
+				log.PrintLn("msg", "purged tombstones", "count", purged)
+			}
+		}
+	}
+}
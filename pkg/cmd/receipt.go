@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+)
+
+// Receipt records the position of the last event appended on behalf
+// of a request, which tells readers how far the read side has to catch
+// up to reflect the request.
+type Receipt struct {
+	mu       sync.Mutex
+	position int64
+}
+
+type receiptKey struct{}
+
+// ContextWithReceipt returns a context whose appended events
+// are recorded in the returned Receipt.
+func ContextWithReceipt(ctx context.Context) (context.Context, *Receipt) {
+	receipt := &Receipt{}
+	return context.WithValue(ctx, receiptKey{}, receipt), receipt
+}
+
+// Position returns 0 if no event was appended.
+func (r *Receipt) Position() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.position
+}
+
+// recordAppend stores the position of the last appended event
+// in the receipt carried by ctx, if any.
+func recordAppend(ctx context.Context, appended []Event) {
+	receipt, ok := ctx.Value(receiptKey{}).(*Receipt)
+	if !ok || len(appended) == 0 {
+		return
+	}
+
+	receipt.mu.Lock()
+	defer receipt.mu.Unlock()
+
+	if position := appended[len(appended)-1].Position; position > receipt.position {
+		receipt.position = position
+	}
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"context"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/log"
+)
+
+// Repository keeps articles as streams of events in an EventStore.
+type Repository struct {
+	store     EventStore
+	codec     EventCodec
+	snapshots SnapshotStore
+	policy    SnapshotPolicy
+}
+
+type RepositoryOption func(*Repository)
+
+// WithSnapshots makes the repository load articles from their latest
+// snapshot and take a new one when the policy says replaying
+// the events after it took too long.
+func WithSnapshots(snapshots SnapshotStore, policy SnapshotPolicy) RepositoryOption {
+	return func(r *Repository) {
+		r.snapshots = snapshots
+		r.policy = policy
+	}
+}
+
+func NewRepository(store EventStore, codec EventCodec, opts ...RepositoryOption) Repository {
+	r := Repository{
+		store: store,
+		codec: codec,
+	}
+
+	for _, opt := range opts {
+		opt(&r)
+	}
+
+	return r
+}
+
+// Load rebuilds the article from its latest snapshot, if there is one,
+// and the events after it. Deleted articles are returned too,
+// callers should check IsDeleted.
+func (r Repository) Load(ctx context.Context, id string) (entity.Article, error) {
+	article, ok := r.latestSnapshot(ctx, id)
+
+	records, err := r.store.Load(ctx, id, article.Version+1)
+	if err != nil {
+		return entity.Article{}, err
+	}
+
+	if !ok && len(records) == 0 {
+		return entity.Article{}, entity.NotFound(id)
+	}
+
+	for _, record := range records {
+		event, _, err := r.codec.Decode(record)
+		if err != nil {
+			return entity.Article{}, err
+		}
+		if err := article.Apply(event); err != nil {
+			return entity.Article{}, err
+		}
+	}
+
+	// A purged article replayed from events has no snapshot of its own
+	// yet, so an older one may still hold its content.
+	if r.snapshots != nil && (r.policy.due(records) || article.Purged && len(records) > 0) {
+		r.takeSnapshot(ctx, article)
+	}
+
+	return article, nil
+}
+
+// latestSnapshot returns the article as of its latest usable snapshot.
+// Snapshots which fail to load are skipped in favour of a full replay.
+func (r Repository) latestSnapshot(ctx context.Context, id string) (entity.Article, bool) {
+	if r.snapshots == nil {
+		return entity.Article{}, false
+	}
+
+	snapshot, ok, err := r.snapshots.Latest(ctx, id)
+	if err != nil {
+		log.PrintLn("msg", "failed to load a snapshot", "aggregate_id", id, "err", err)
+		return entity.Article{}, false
+	}
+
+	if !ok || snapshot.SchemaVersion != SnapshotSchemaVersion {
+		return entity.Article{}, false
+	}
+
+	article, err := decodeSnapshot(snapshot)
+	if err != nil {
+		log.PrintLn("msg", "failed to decode a snapshot", "aggregate_id", id, "err", err)
+		return entity.Article{}, false
+	}
+
+	return article, true
+}
+
+// takeSnapshot only logs failures, since snapshots are an optimization.
+func (r Repository) takeSnapshot(ctx context.Context, article entity.Article) {
+	snapshot, err := encodeSnapshot(article)
+	if err == nil {
+		err = r.snapshots.Save(ctx, snapshot)
+	}
+	if err != nil {
+		log.PrintLn("msg", "failed to save a snapshot", "aggregate_id", article.Id, "err", err)
+	}
+}
+
+// Save appends the events recorded by the article since it was loaded
+// and clears them. It fails with an error matching entity.ErrConflict
+// if the stream was changed in the meantime.
+//
+// Purging the article scrubs the payloads of its earlier events in
+// the same write as the append, and replaces its snapshot with one
+// of the purged article, which no longer holds its content.
+func (r Repository) Save(ctx context.Context, article *entity.Article, meta EventMetadata) ([]Event, error) {
+	events := article.Events()
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	expectedVersion := article.Version - int64(len(events))
+
+	records := make([]Event, 0, len(events))
+	for i, event := range events {
+		record, err := r.codec.Encode(expectedVersion+int64(i)+1, event, meta)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	if !article.Purged {
+		appended, err := r.store.Append(ctx, article.Id, expectedVersion, records)
+		if err != nil {
+			return nil, err
+		}
+
+		article.ClearEvents()
+		return appended, nil
+	}
+
+	data, err := r.scrubbed(ctx, article.Id, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	appended, err := r.store.AppendAndScrub(ctx, article.Id, expectedVersion, records, data)
+	if err != nil {
+		return nil, err
+	}
+
+	article.ClearEvents()
+	if r.snapshots != nil {
+		r.takeSnapshot(ctx, *article)
+	}
+	return appended, nil
+}
+
+// scrubbed returns the data of the events of the article up to
+// the version with their payloads emptied.
+func (r Repository) scrubbed(ctx context.Context, id string, version int64) (map[int64][]byte, error) {
+	records, err := r.store.Load(ctx, id, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[int64][]byte, len(records))
+	for _, record := range records {
+		if record.Version > version {
+			break
+		}
+		if data[record.Version], err = r.codec.Scrub(record); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+func (r Repository) Close() error {
+	return r.store.Close()
+}
@@ -0,0 +1,129 @@
+package cmd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/idgen"
+	"github.com/krixlion/dev-forum_article/pkg/memory"
+)
+
+func TestRepositoryReplaysSavedEvents(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	repo := cmd.NewRepository(
+		memory.NewEventStore(clock.System{}),
+		cmd.NewEventCodec(cmd.DefaultAggregateType, idgen.NewSequenceGenerator("event-")),
+	)
+
+	article, err := entity.NewArticle("article", "user", "title", "body", []string{"go"}, now)
+	if err != nil {
+		t.Fatalf("Failed to create article, err: %v", err)
+	}
+	if err := article.Publish(now); err != nil {
+		t.Fatalf("Failed to publish article, err: %v", err)
+	}
+
+	if _, err := repo.Save(ctx, &article, cmd.EventMetadata{}); err != nil {
+		t.Fatalf("Failed to save article, err: %v", err)
+	}
+
+	stale := article.Clone()
+
+	article.Rename("new title", now.Add(time.Minute))
+	article.EditBody("new body", now.Add(time.Minute))
+	if err := article.Delete(now.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to delete article, err: %v", err)
+	}
+
+	if _, err := repo.Save(ctx, &article, cmd.EventMetadata{CorrelationId: "request"}); err != nil {
+		t.Fatalf("Failed to save article, err: %v", err)
+	}
+
+	got, err := repo.Load(ctx, "article")
+	if err != nil {
+		t.Fatalf("Failed to load article, err: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, article) {
+		t.Fatalf("Replayed article is not equal, got: %+v, want: %+v", got, article)
+	}
+	if got.Version != 5 {
+		t.Fatalf("Unexpected version, got: %v, want: %v", got.Version, 5)
+	}
+
+	stale.Rename("lost update", now.Add(time.Minute))
+	if _, err := repo.Save(ctx, &stale, cmd.EventMetadata{}); !errors.Is(err, entity.ErrConflict) {
+		t.Fatalf("Stale save was not rejected, err: %v", err)
+	}
+}
+
+func TestRepositoryLoadsFromSnapshot(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	events := memory.NewEventStore(clock.System{})
+	snapshots := memory.NewSnapshots()
+	repo := cmd.NewRepository(events,
+		cmd.NewEventCodec(cmd.DefaultAggregateType, idgen.NewSequenceGenerator("event-")),
+		cmd.WithSnapshots(snapshots, cmd.SnapshotPolicy{Every: 3}),
+	)
+
+	article, err := entity.NewArticle("article", "user", "title", "body", nil, now)
+	if err != nil {
+		t.Fatalf("Failed to create article, err: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		article.EditBody(fmt.Sprintf("body %d", i), now.Add(time.Duration(i)*time.Minute))
+	}
+	if _, err := repo.Save(ctx, &article, cmd.EventMetadata{}); err != nil {
+		t.Fatalf("Failed to save article, err: %v", err)
+	}
+
+	if _, err := repo.Load(ctx, "article"); err != nil {
+		t.Fatalf("Failed to load article, err: %v", err)
+	}
+
+	snapshot, ok, err := snapshots.Latest(ctx, "article")
+	if err != nil || !ok {
+		t.Fatalf("Snapshot was not taken, ok: %v, err: %v", ok, err)
+	}
+	if snapshot.Version != 5 {
+		t.Fatalf("Unexpected snapshot version, got: %v, want: %v", snapshot.Version, 5)
+	}
+
+	article.Rename("new title", now.Add(time.Hour))
+	if _, err := repo.Save(ctx, &article, cmd.EventMetadata{}); err != nil {
+		t.Fatalf("Failed to save article, err: %v", err)
+	}
+
+	got, err := repo.Load(ctx, "article")
+	if err != nil {
+		t.Fatalf("Failed to load article, err: %v", err)
+	}
+	if !reflect.DeepEqual(got, article) {
+		t.Fatalf("Article loaded from snapshot is not equal, got: %+v, want: %+v", got, article)
+	}
+
+	// Snapshots of another schema version must not be decoded.
+	outdated := cmd.Snapshot{AggregateId: "article", Version: 6, SchemaVersion: cmd.SnapshotSchemaVersion + 1, Data: []byte("{")}
+	if err := snapshots.Save(ctx, outdated); err != nil {
+		t.Fatalf("Failed to save snapshot, err: %v", err)
+	}
+
+	got, err = repo.Load(ctx, "article")
+	if err != nil {
+		t.Fatalf("Failed to replay article, err: %v", err)
+	}
+	if !reflect.DeepEqual(got, article) {
+		t.Fatalf("Replayed article is not equal, got: %+v, want: %+v", got, article)
+	}
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+)
+
+// SnapshotSchemaVersion is the version of the snapshot encoding.
+// Snapshots of other versions are ignored and the aggregate
+// is rebuilt by replaying all of its events.
+const SnapshotSchemaVersion = 1
+
+// Snapshot is the encoded state of an aggregate at a version.
+type Snapshot struct {
+	AggregateId   string
+	Version       int64
+	SchemaVersion int32
+	Data          []byte
+}
+
+// SnapshotStore keeps the latest snapshot of every aggregate.
+type SnapshotStore interface {
+	// Save replaces the snapshot of the aggregate
+	// unless the stored one is at a later version.
+	Save(ctx context.Context, snapshot Snapshot) error
+	// Latest returns false if the aggregate has no snapshot.
+	Latest(ctx context.Context, aggregateId string) (Snapshot, bool, error)
+}
+
+// SnapshotPolicy decides when loading an aggregate is slow enough
+// to take a snapshot. Zero limits are not enforced.
+type SnapshotPolicy struct {
+	// Every is the number of events replayed on top of the latest snapshot.
+	Every int
+	// MaxBytes is the size of events replayed on top of the latest snapshot.
+	MaxBytes int
+}
+
+func DefaultSnapshotPolicy() SnapshotPolicy {
+	return SnapshotPolicy{
+		Every:    100,
+		MaxBytes: 1 << 20,
+	}
+}
+
+func (p SnapshotPolicy) due(events []Event) bool {
+	if p.Every > 0 && len(events) >= p.Every {
+		return true
+	}
+
+	if p.MaxBytes > 0 {
+		size := 0
+		for _, event := range events {
+			size += len(event.Data)
+		}
+		return size >= p.MaxBytes
+	}
+
+	return false
+}
+
+// articleState is the encoding of a snapshot at SnapshotSchemaVersion.
+type articleState struct {
+	Id          string    `json:"id"`
+	UserId      string    `json:"user_id"`
+	Title       string    `json:"title"`
+	Body        string    `json:"body"`
+	Tags        []string  `json:"tags,omitempty"`
+	Version     int64     `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	PublishedAt time.Time `json:"published_at"`
+	DeletedAt   time.Time `json:"deleted_at"`
+	Purged      bool      `json:"purged,omitempty"`
+}
+
+func encodeSnapshot(article entity.Article) (Snapshot, error) {
+	data, err := json.Marshal(articleState{
+		Id:          article.Id,
+		UserId:      article.UserId,
+		Title:       article.Title,
+		Body:        article.Body,
+		Tags:        article.Tags,
+		Version:     article.Version,
+		CreatedAt:   article.CreatedAt,
+		UpdatedAt:   article.UpdatedAt,
+		PublishedAt: article.PublishedAt,
+		DeletedAt:   article.DeletedAt,
+		Purged:      article.Purged,
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	return Snapshot{
+		AggregateId:   article.Id,
+		Version:       article.Version,
+		SchemaVersion: SnapshotSchemaVersion,
+		Data:          data,
+	}, nil
+}
+
+func decodeSnapshot(snapshot Snapshot) (entity.Article, error) {
+	var state articleState
+	if err := json.Unmarshal(snapshot.Data, &state); err != nil {
+		return entity.Article{}, err
+	}
+
+	return entity.Article{
+		Id:          state.Id,
+		UserId:      state.UserId,
+		Title:       state.Title,
+		Body:        state.Body,
+		Tags:        state.Tags,
+		Version:     state.Version,
+		CreatedAt:   state.CreatedAt,
+		UpdatedAt:   state.UpdatedAt,
+		PublishedAt: state.PublishedAt,
+		DeletedAt:   state.DeletedAt,
+		Purged:      state.Purged,
+	}, nil
+}
@@ -1 +1,29 @@
 package cmd
+
+import (
+	"context"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+)
+
+// MutateFunc changes the current state of an article in place
+// through its methods. Returning an error aborts the update.
+type MutateFunc func(*entity.Article) error
+
+// Storage is the write side of the article repository.
+// Create and Update return the article as it was stored.
+type Storage interface {
+	Create(context.Context, entity.Article) (entity.Article, error)
+	// Update atomically applies mutate to the current state of the article.
+	Update(ctx context.Context, id string, mutate MutateFunc) (entity.Article, error)
+	// Delete replaces the article with a tombstone
+	// and returns the tombstone, the article with DeletedAt set.
+	Delete(ctx context.Context, id string) (entity.Article, error)
+	// Restore revives the article if its tombstone was created after deletedAfter.
+	Restore(ctx context.Context, id string, deletedAfter time.Time) (entity.Article, error)
+	// Purge permanently removes tombstones created before deletedBefore
+	// and returns how many were removed.
+	Purge(ctx context.Context, deletedBefore time.Time) (int, error)
+	Close() error
+}
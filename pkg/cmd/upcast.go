@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/krixlion/dev-forum_article/pkg/grpc/pb"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Upcaster turns the payload of an event written at one schema version
+// into its shape at the next version. It may change the payload type.
+type Upcaster func(payload *anypb.Any) (*anypb.Any, error)
+
+type upcasterKey struct {
+	payloadType string
+	fromVersion int32
+}
+
+// Upcasters is a registry of upcasters applied to events written
+// at older schema versions when they are decoded. Payloads whose type
+// has no upcaster for a version are assumed to be unchanged by it.
+type Upcasters struct {
+	upcasters map[upcasterKey]Upcaster
+}
+
+func NewUpcasters() *Upcasters {
+	return &Upcasters{
+		upcasters: make(map[upcasterKey]Upcaster),
+	}
+}
+
+// DefaultUpcasters returns the upcasters of every payload changed since
+// the first schema version. An upcaster has to be registered here
+// whenever EventSchemaVersion is bumped because of a payload change.
+func DefaultUpcasters() *Upcasters {
+	u := NewUpcasters()
+
+	// Version 2 moved the payloads into the article.events.v1 package.
+	for _, payload := range []proto.Message{
+		&pb.ArticleCreated{},
+		&pb.ArticleTitleChanged{},
+		&pb.ArticleBodyEdited{},
+		&pb.ArticleTagsChanged{},
+		&pb.ArticlePublished{},
+		&pb.ArticleDeleted{},
+		&pb.ArticleRestored{},
+		&pb.ArticlePurged{},
+	} {
+		name := payload.ProtoReflect().Descriptor().FullName()
+		u.Register(string(name.Name()), 1, rename(name))
+	}
+
+	return u
+}
+
+// rename returns an Upcaster which only changes the type of the payload,
+// its encoding is the same.
+func rename(to protoreflect.FullName) Upcaster {
+	return func(payload *anypb.Any) (*anypb.Any, error) {
+		return &anypb.Any{
+			TypeUrl: typeURLPrefix + string(to),
+			Value:   payload.GetValue(),
+		}, nil
+	}
+}
+
+// typeURLPrefix is put in front of the full names of payloads by anypb.New.
+const typeURLPrefix = "type.googleapis.com/"
+
+// Register sets the upcaster of payloads of the type written at fromVersion.
+// The type is the full name of the message at that version, including
+// its package, e.g. "article.events.v1.ArticleCreated". Names of payloads
+// written at version 1 had no package, e.g. "ArticleCreated".
+// It is not safe to call concurrently with Upcast.
+func (u *Upcasters) Register(payloadType string, fromVersion int32, upcaster Upcaster) {
+	u.upcasters[upcasterKey{payloadType: payloadType, fromVersion: fromVersion}] = upcaster
+}
+
+// Upcast brings the envelope's payload and schema version up to toVersion.
+func (u *Upcasters) Upcast(envelope *pb.EventEnvelope, toVersion int32) error {
+	payload := envelope.GetPayload()
+
+	for version := envelope.GetSchemaVersion(); version < toVersion; version++ {
+		upcaster, ok := u.upcasters[upcasterKey{payloadType: payloadType(payload), fromVersion: version}]
+		if !ok {
+			continue
+		}
+
+		upcasted, err := upcaster(payload)
+		if err != nil {
+			return fmt.Errorf("failed to upcast event %q from schema version %d: %w", envelope.GetEventId(), version, err)
+		}
+		payload = upcasted
+	}
+
+	envelope.Payload = payload
+	envelope.SchemaVersion = toVersion
+	return nil
+}
+
+// payloadType returns the full name of the message in payload without
+// resolving it, since types of old payloads may no longer exist.
+func payloadType(payload *anypb.Any) string {
+	url := payload.GetTypeUrl()
+	return url[strings.LastIndex(url, "/")+1:]
+}
@@ -0,0 +1,148 @@
+package cmd_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/grpc/pb"
+	"github.com/krixlion/dev-forum_article/pkg/idgen"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+var update = flag.Bool("update", false, "Update golden files")
+
+// TestReplayHistoricalEvents replays events as they were written by
+// earlier releases. The fixture must never change, new schema versions
+// need upcasters which keep replaying it into the golden articles.
+func TestReplayHistoricalEvents(t *testing.T) {
+	file, err := os.Open(filepath.Join("testdata", "events.jsonl"))
+	if err != nil {
+		t.Fatalf("Failed to open fixture, err: %v", err)
+	}
+	defer file.Close()
+
+	codec := cmd.NewEventCodec(cmd.DefaultAggregateType, idgen.NewSequenceGenerator("event-"))
+	streams := make(map[string][]entity.Event)
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		envelope := &pb.EventEnvelope{}
+		if err := (protojson.UnmarshalOptions{Resolver: legacyTypes{protoregistry.GlobalTypes}}).Unmarshal(scanner.Bytes(), envelope); err != nil {
+			t.Fatalf("Failed to parse line %d, err: %v", line, err)
+		}
+
+		data, err := proto.Marshal(envelope)
+		if err != nil {
+			t.Fatalf("Failed to marshal line %d, err: %v", line, err)
+		}
+
+		event, _, err := codec.Decode(cmd.Event{
+			AggregateId: envelope.GetAggregateId(),
+			Version:     envelope.GetSequence(),
+			Data:        data,
+		})
+		if err != nil {
+			t.Fatalf("Failed to decode line %d, err: %v", line, err)
+		}
+
+		streams[event.AggregateId()] = append(streams[event.AggregateId()], event)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Failed to read fixture, err: %v", err)
+	}
+
+	articles := make(map[string]entity.Article, len(streams))
+	for id, events := range streams {
+		article, err := entity.Replay(events)
+		if err != nil {
+			t.Fatalf("Failed to replay %q, err: %v", id, err)
+		}
+		article.ClearEvents()
+		articles[id] = article
+	}
+
+	got, err := json.MarshalIndent(articles, "", "\t")
+	if err != nil {
+		t.Fatalf("Failed to marshal articles, err: %v", err)
+	}
+	got = append(got, '\n')
+
+	golden := filepath.Join("testdata", "events.golden.json")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatalf("Failed to update golden file, err: %v", err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Failed to read golden file, err: %v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Replayed articles differ from %s, got:\n%s", golden, got)
+	}
+}
+
+// legacyTypes resolves payloads of the fixture whose types had no package
+// yet, which protojson needs to parse them. Their type URLs are kept, so
+// that they are decoded the way payloads stored at the time are.
+type legacyTypes struct {
+	*protoregistry.Types
+}
+
+func (r legacyTypes) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	messageType, err := r.Types.FindMessageByURL(url)
+	if errors.Is(err, protoregistry.NotFound) {
+		name := url[strings.LastIndex(url, "/")+1:]
+		return r.Types.FindMessageByName(protoreflect.FullName("article.events.v1." + name))
+	}
+	return messageType, err
+}
+
+func TestUpcastersChainVersions(t *testing.T) {
+	upcasters := cmd.NewUpcasters()
+	upcasters.Register("article.events.v1.ArticleTitleChanged", 1, func(payload *anypb.Any) (*anypb.Any, error) {
+		old := &pb.ArticleTitleChanged{}
+		if err := payload.UnmarshalTo(old); err != nil {
+			return nil, err
+		}
+		return anypb.New(&pb.ArticleTitleChanged{Title: strings.ToUpper(old.GetTitle())})
+	})
+	upcasters.Register("article.events.v1.ArticleTitleChanged", 3, func(*anypb.Any) (*anypb.Any, error) {
+		t.Fatal("Upcaster past the target version was called")
+		return nil, nil
+	})
+
+	payload, err := anypb.New(&pb.ArticleTitleChanged{Title: "title"})
+	if err != nil {
+		t.Fatalf("Failed to pack payload, err: %v", err)
+	}
+	envelope := &pb.EventEnvelope{SchemaVersion: 1, Payload: payload}
+
+	if err := upcasters.Upcast(envelope, 3); err != nil {
+		t.Fatalf("Failed to upcast, err: %v", err)
+	}
+
+	got := &pb.ArticleTitleChanged{}
+	if err := envelope.GetPayload().UnmarshalTo(got); err != nil {
+		t.Fatalf("Failed to unpack payload, err: %v", err)
+	}
+	if got.GetTitle() != "TITLE" || envelope.GetSchemaVersion() != 3 {
+		t.Fatalf("Unexpected upcasted event, title: %q, schema version: %d", got.GetTitle(), envelope.GetSchemaVersion())
+	}
+}
@@ -0,0 +1,103 @@
+package filestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+)
+
+// outboxName is the file keeping the position of the last event
+// published from the store, which makes the segments a cmd.Outbox.
+const outboxName = "outbox.json"
+
+type outboxFile struct {
+	Sent int64 `json:"sent"`
+}
+
+// loadSent must be called after the segments are indexed.
+func (s *Store) loadSent() error {
+	buf, err := os.ReadFile(filepath.Join(s.dir, outboxName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var f outboxFile
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorrupted, outboxName, err)
+	}
+
+	// Events after a torn frame were never acknowledged
+	// to the writer, so they cannot have been sent.
+	s.sent = f.Sent
+	if s.sent > s.position {
+		s.sent = s.position
+	}
+	return nil
+}
+
+func (s *Store) Unsent(ctx context.Context, limit int) ([]cmd.Event, error) {
+	s.mu.RLock()
+	sent := s.sent
+	s.mu.RUnlock()
+
+	return s.ReadAll(ctx, sent, limit)
+}
+
+func (s *Store) MarkSent(_ context.Context, position int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if position > s.position {
+		return fmt.Errorf("cannot mark position %d as sent, head is at %d", position, s.position)
+	}
+	if position <= s.sent {
+		return nil
+	}
+
+	buf, err := json.Marshal(outboxFile{Sent: position})
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(s.dir, outboxName, buf); err != nil {
+		return err
+	}
+
+	s.sent = position
+	return nil
+}
+
+// writeFile atomically replaces the named file in dir with data.
+func writeFile(dir, name string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
@@ -0,0 +1,205 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+)
+
+// journalName is the file holding the frames of an AppendAndScrub
+// until all of them are written.
+const journalName = "scrub.journal"
+
+// rewrite is a frame to be written at offset of the segment
+// starting at firstPosition, either over a frame or at its end.
+type rewrite struct {
+	FirstPosition int64  `json:"first_position"`
+	Offset        int64  `json:"offset"`
+	Frame         []byte `json:"frame"`
+}
+
+// AppendAndScrub rewrites the frames holding the scrubbed events in place.
+// The new payload is padded with spaces to the length of the old one,
+// so the frames keep their offsets. The rewritten frames and the frame
+// of the appended events are written to a journal first, which Open
+// replays if the store crashed before all of them were written.
+func (s *Store) AppendAndScrub(_ context.Context, aggregateId string, expectedVersion int64, events []cmd.Event, data map[int64][]byte) ([]cmd.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed != nil {
+		return nil, s.failed
+	}
+
+	version := s.version(aggregateId)
+	if version != expectedVersion {
+		return nil, cmd.ConcurrencyConflict(aggregateId, expectedVersion, version)
+	}
+
+	for v := range data {
+		if v < 1 || v > version {
+			return nil, fmt.Errorf("event %d of %q does not exist", v, aggregateId)
+		}
+	}
+
+	rewrites, err := s.scrubbed(aggregateId, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		f        frame
+		appended []cmd.Event
+		buf      []byte
+		seg      *segment
+	)
+	if len(events) > 0 {
+		f, appended = s.newFrame(aggregateId, expectedVersion, events)
+		if buf, err = encodeFrame(f); err != nil {
+			return nil, err
+		}
+		if seg, err = s.segmentFor(buf, appended[0].Position); err != nil {
+			return nil, err
+		}
+		rewrites = append(rewrites, rewrite{FirstPosition: seg.firstPosition, Offset: seg.size, Frame: buf})
+	}
+
+	if len(rewrites) == 0 {
+		return nil, nil
+	}
+
+	journal, err := json.Marshal(rewrites)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(s.dir, journalName, journal); err != nil {
+		return nil, err
+	}
+
+	// Nothing can be undone past this point.
+	if err := replay(s.dir, rewrites); err != nil {
+		s.failed = fmt.Errorf("filestore: write interrupted, the store has to be reopened: %w", err)
+		return nil, s.failed
+	}
+
+	if seg != nil {
+		s.index(seg, seg.size, int64(len(buf)), f)
+		seg.size += int64(len(buf))
+	}
+
+	// A journal left behind is harmless, replaying it writes the same frames.
+	return appended, removeJournal(s.dir)
+}
+
+// scrubbed returns the frames of the aggregate with the data replaced.
+func (s *Store) scrubbed(aggregateId string, data map[int64][]byte) ([]rewrite, error) {
+	var rewrites []rewrite
+	for _, ref := range s.streams[aggregateId] {
+		f, err := ref.read()
+		if err != nil {
+			return nil, err
+		}
+
+		changed := false
+		for i, r := range f.Events {
+			if d, ok := data[r.Version]; ok {
+				f.Events[i].Data = d
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		buf, err := encodeFrameOfLength(f, ref.length)
+		if err != nil {
+			return nil, err
+		}
+		rewrites = append(rewrites, rewrite{FirstPosition: ref.segment.firstPosition, Offset: ref.offset, Frame: buf})
+	}
+
+	return rewrites, nil
+}
+
+// encodeFrameOfLength encodes the frame padded to a payload of length bytes.
+func encodeFrameOfLength(f frame, length int64) ([]byte, error) {
+	payload, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(payload)) > length {
+		return nil, fmt.Errorf("scrubbed frame of %q is longer than the original", f.AggregateId)
+	}
+	payload = append(payload, bytes.Repeat([]byte{' '}, int(length)-len(payload))...)
+
+	buf := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[headerSize:], payload)
+	return buf, nil
+}
+
+// replayJournal finishes an AppendAndScrub interrupted by a crash.
+// It must be called before the segments are opened.
+func replayJournal(dir string) error {
+	buf, err := os.ReadFile(filepath.Join(dir, journalName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// The journal is renamed into place once complete.
+	var rewrites []rewrite
+	if err := json.Unmarshal(buf, &rewrites); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorrupted, journalName, err)
+	}
+
+	if err := replay(dir, rewrites); err != nil {
+		return err
+	}
+
+	return removeJournal(dir)
+}
+
+// replay writes the frames into the segments and syncs them.
+// Writing a frame again is harmless, so it may be repeated.
+func replay(dir string, rewrites []rewrite) error {
+	for _, r := range rewrites {
+		name := filepath.Join(dir, segmentName(r.FirstPosition))
+		file, err := os.OpenFile(name, os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+
+		_, err = file.WriteAt(r.Frame, r.Offset)
+		if err == nil {
+			err = file.Sync()
+		}
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func removeJournal(dir string) error {
+	if err := os.Remove(filepath.Join(dir, journalName)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
@@ -0,0 +1,101 @@
+package filestore
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+)
+
+const snapshotExt = ".snap"
+
+// Snapshots is a cmd.SnapshotStore keeping the latest snapshot
+// of every aggregate in its own file. Files are replaced atomically,
+// so a crash leaves either the previous or the new snapshot.
+type Snapshots struct {
+	mu  sync.Mutex
+	dir string
+}
+
+type snapshotFile struct {
+	AggregateId   string `json:"aggregate_id"`
+	Version       int64  `json:"version"`
+	SchemaVersion int32  `json:"schema_version"`
+	Data          []byte `json:"data"`
+}
+
+// OpenSnapshots opens the snapshots in dir, creating the directory if needed.
+func OpenSnapshots(dir string) (*Snapshots, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Snapshots{dir: dir}, nil
+}
+
+// name hex encodes the aggregate ID, since IDs supplied
+// in import mode may not be valid file names.
+func (s *Snapshots) name(aggregateId string) string {
+	return hex.EncodeToString([]byte(aggregateId)) + snapshotExt
+}
+
+func (s *Snapshots) Save(_ context.Context, snapshot cmd.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok, err := s.read(snapshot.AggregateId)
+	if err != nil {
+		return err
+	}
+	if ok && stored.Version > snapshot.Version {
+		return nil
+	}
+
+	buf, err := json.Marshal(snapshotFile{
+		AggregateId:   snapshot.AggregateId,
+		Version:       snapshot.Version,
+		SchemaVersion: snapshot.SchemaVersion,
+		Data:          snapshot.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeFile(s.dir, s.name(snapshot.AggregateId), buf)
+}
+
+func (s *Snapshots) Latest(_ context.Context, aggregateId string) (cmd.Snapshot, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.read(aggregateId)
+}
+
+// read must be called with s.mu held.
+func (s *Snapshots) read(aggregateId string) (cmd.Snapshot, bool, error) {
+	buf, err := os.ReadFile(filepath.Join(s.dir, s.name(aggregateId)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return cmd.Snapshot{}, false, nil
+	}
+	if err != nil {
+		return cmd.Snapshot{}, false, err
+	}
+
+	var f snapshotFile
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return cmd.Snapshot{}, false, err
+	}
+
+	return cmd.Snapshot{
+		AggregateId:   f.AggregateId,
+		Version:       f.Version,
+		SchemaVersion: f.SchemaVersion,
+		Data:          f.Data,
+	}, true, nil
+}
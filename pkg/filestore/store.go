@@ -0,0 +1,517 @@
+// Package filestore implements a durable cmd.EventStore on top of
+// segmented append-only files kept in a local directory.
+//
+// Every Append writes a single frame holding all of its events,
+// which makes appends atomic. A frame is a 4-byte big-endian payload
+// length, a 4-byte CRC-32 (Castagnoli) of the payload and the JSON
+// encoded payload. A torn frame at the end of the newest segment,
+// left by a crash in the middle of a write, is truncated on Open.
+//
+// The Store is also a cmd.Outbox. The position of the last published
+// event is kept in a separate file, so appending an event is the same
+// write that queues it for publishing.
+//
+// AppendAndScrub is the only change made to written frames. It rewrites
+// them in place at the same length and appends its frame through a journal
+// which Open replays, so a crash cannot leave the append without the scrub
+// or a frame half scrubbed.
+//
+// A directory must not be opened by more than one Store at a time.
+package filestore
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+)
+
+// DefaultSegmentSize is the size after which a new segment is started.
+const DefaultSegmentSize = 64 << 20
+
+const (
+	segmentExt = ".seg"
+	headerSize = 8
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupted is returned by Open when a segment other than
+// the newest one contains an invalid frame.
+var ErrCorrupted = errors.New("filestore: corrupted segment")
+
+type segment struct {
+	file *os.File
+	// firstPosition is the position of the first event in the segment.
+	firstPosition int64
+	size          int64
+}
+
+// frameRef locates a frame holding events of a single aggregate.
+type frameRef struct {
+	segment       *segment
+	offset        int64
+	firstVersion  int64
+	firstPosition int64
+	count         int64
+	// length of the payload of the frame.
+	length int64
+}
+
+func (f frameRef) lastVersion() int64 {
+	return f.firstVersion + f.count - 1
+}
+
+// frame is the payload of a single Append.
+type frame struct {
+	AggregateId string   `json:"aggregate_id"`
+	Events      []record `json:"events"`
+}
+
+type record struct {
+	Id         string    `json:"id,omitempty"`
+	Version    int64     `json:"version"`
+	Position   int64     `json:"position"`
+	Type       string    `json:"type"`
+	Data       []byte    `json:"data"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+type Store struct {
+	mu          sync.RWMutex
+	dir         string
+	segmentSize int64
+	clock       clock.Clock
+	segments    []*segment
+	// streams indexes frames of every aggregate in version order.
+	streams map[string][]frameRef
+	// frames indexes frames of all aggregates in position order.
+	frames []frameRef
+	// position of the last appended event.
+	position int64
+	// sent is the position of the last event published from the outbox.
+	sent int64
+	// failed is set when a journaled write fails half way. Writes are
+	// refused until the store is reopened, which finishes the write.
+	failed error
+}
+
+type Option func(*Store)
+
+// WithSegmentSize sets the size after which a new segment is started.
+// A single frame larger than the size still goes into one segment.
+func WithSegmentSize(size int64) Option {
+	return func(s *Store) {
+		s.segmentSize = size
+	}
+}
+
+// WithClock sets the source of RecordedAt of appended events.
+func WithClock(clock clock.Clock) Option {
+	return func(s *Store) {
+		s.clock = clock
+	}
+}
+
+// Open opens the store in dir, creating the directory if needed,
+// and indexes the existing segments.
+func Open(dir string, opts ...Option) (*Store, error) {
+	s := &Store{
+		dir:         dir,
+		segmentSize: DefaultSegmentSize,
+		clock:       clock.System{},
+		streams:     make(map[string][]frameRef),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	if err := replayJournal(dir); err != nil {
+		return nil, err
+	}
+
+	names, err := segmentNames(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, name := range names {
+		if err := s.openSegment(name, i == len(names)-1); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	if len(s.segments) == 0 {
+		if err := s.createSegment(1); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.loadSent(); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func segmentNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), segmentExt) {
+			names = append(names, entry.Name())
+		}
+	}
+
+	// Names are zero-padded, so they sort by their first position.
+	sort.Strings(names)
+	return names, nil
+}
+
+// openSegment indexes frames of the segment. A torn frame is truncated
+// if the segment is the newest one and reported as corruption otherwise.
+func (s *Store) openSegment(name string, newest bool) error {
+	firstPosition, err := strconv.ParseInt(strings.TrimSuffix(name, segmentExt), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: unexpected segment name %q", ErrCorrupted, name)
+	}
+
+	file, err := os.OpenFile(filepath.Join(s.dir, name), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+
+	seg := &segment{file: file, firstPosition: firstPosition}
+	s.segments = append(s.segments, seg)
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	for {
+		f, size, err := readFrame(file, seg.size, info.Size())
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			if !newest {
+				return fmt.Errorf("%w: %s at offset %d: %v", ErrCorrupted, name, seg.size, err)
+			}
+			return file.Truncate(seg.size)
+		}
+
+		s.index(seg, seg.size, size, f)
+		seg.size += size
+	}
+}
+
+func (s *Store) createSegment(firstPosition int64) error {
+	name := filepath.Join(s.dir, segmentName(firstPosition))
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if err := syncDir(s.dir); err != nil {
+		file.Close()
+		return err
+	}
+
+	s.segments = append(s.segments, &segment{file: file, firstPosition: firstPosition})
+	return nil
+}
+
+func segmentName(firstPosition int64) string {
+	return fmt.Sprintf("%020d%s", firstPosition, segmentExt)
+}
+
+// index adds the frame of the given size at offset of the segment.
+func (s *Store) index(seg *segment, offset, size int64, f frame) {
+	if len(f.Events) == 0 {
+		return
+	}
+
+	ref := frameRef{
+		segment:       seg,
+		offset:        offset,
+		firstVersion:  f.Events[0].Version,
+		firstPosition: f.Events[0].Position,
+		count:         int64(len(f.Events)),
+		length:        size - headerSize,
+	}
+	s.streams[f.AggregateId] = append(s.streams[f.AggregateId], ref)
+	s.frames = append(s.frames, ref)
+	s.position = f.Events[len(f.Events)-1].Position
+}
+
+func (s *Store) version(aggregateId string) int64 {
+	refs := s.streams[aggregateId]
+	if len(refs) == 0 {
+		return 0
+	}
+	return refs[len(refs)-1].lastVersion()
+}
+
+func (s *Store) Append(_ context.Context, aggregateId string, expectedVersion int64, events []cmd.Event) ([]cmd.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed != nil {
+		return nil, s.failed
+	}
+
+	if version := s.version(aggregateId); version != expectedVersion {
+		return nil, cmd.ConcurrencyConflict(aggregateId, expectedVersion, version)
+	}
+
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	f, appended := s.newFrame(aggregateId, expectedVersion, events)
+	buf, err := encodeFrame(f)
+	if err != nil {
+		return nil, err
+	}
+
+	seg, err := s.segmentFor(buf, appended[0].Position)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := write(seg, buf); err != nil {
+		return nil, err
+	}
+
+	s.index(seg, seg.size, int64(len(buf)), f)
+	seg.size += int64(len(buf))
+
+	return appended, nil
+}
+
+// newFrame returns the frame appending the events after expectedVersion.
+func (s *Store) newFrame(aggregateId string, expectedVersion int64, events []cmd.Event) (frame, []cmd.Event) {
+	now := s.clock.Now()
+	f := frame{AggregateId: aggregateId}
+	appended := make([]cmd.Event, 0, len(events))
+	for i, event := range events {
+		event.AggregateId = aggregateId
+		event.Version = expectedVersion + int64(i) + 1
+		event.Position = s.position + int64(i) + 1
+		event.RecordedAt = now
+		appended = append(appended, event)
+
+		f.Events = append(f.Events, record{
+			Id:         event.Id,
+			Version:    event.Version,
+			Position:   event.Position,
+			Type:       event.Type,
+			Data:       event.Data,
+			RecordedAt: event.RecordedAt,
+		})
+	}
+
+	return f, appended
+}
+
+// segmentFor returns the segment the frame is appended to,
+// starting a new one if the newest one is full.
+func (s *Store) segmentFor(buf []byte, firstPosition int64) (*segment, error) {
+	seg := s.segments[len(s.segments)-1]
+	if seg.size > 0 && seg.size+int64(len(buf)) > s.segmentSize {
+		if err := s.createSegment(firstPosition); err != nil {
+			return nil, err
+		}
+		seg = s.segments[len(s.segments)-1]
+	}
+	return seg, nil
+}
+
+// write makes the frame durable or leaves the segment as it was.
+func write(seg *segment, buf []byte) error {
+	_, err := seg.file.WriteAt(buf, seg.size)
+	if err == nil {
+		err = seg.file.Sync()
+	}
+	if err != nil {
+		seg.file.Truncate(seg.size)
+		return err
+	}
+	return nil
+}
+
+func (s *Store) Load(_ context.Context, aggregateId string, fromVersion int64) ([]cmd.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []cmd.Event
+	for _, ref := range s.streams[aggregateId] {
+		if ref.lastVersion() < fromVersion {
+			continue
+		}
+
+		f, err := ref.read()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range f.Events {
+			if r.Version >= fromVersion {
+				events = append(events, r.event(f.AggregateId))
+			}
+		}
+	}
+
+	return events, nil
+}
+
+func (s *Store) ReadAll(_ context.Context, afterPosition int64, limit int) ([]cmd.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Find the first frame holding an event after the position.
+	i := sort.Search(len(s.frames), func(i int) bool {
+		return s.frames[i].firstPosition+s.frames[i].count-1 > afterPosition
+	})
+
+	var events []cmd.Event
+	for ; i < len(s.frames) && len(events) < limit; i++ {
+		f, err := s.frames[i].read()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range f.Events {
+			if r.Position > afterPosition && len(events) < limit {
+				events = append(events, r.event(f.AggregateId))
+			}
+		}
+	}
+
+	return events, nil
+}
+
+func (s *Store) Head(context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.position, nil
+}
+
+func (f frameRef) read() (frame, error) {
+	fr, _, err := readFrame(f.segment.file, f.offset, f.segment.size)
+	if err != nil {
+		return frame{}, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	return fr, nil
+}
+
+func (r record) event(aggregateId string) cmd.Event {
+	return cmd.Event{
+		Id:          r.Id,
+		AggregateId: aggregateId,
+		Version:     r.Version,
+		Position:    r.Position,
+		Type:        r.Type,
+		Data:        r.Data,
+		RecordedAt:  r.RecordedAt,
+	}
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for _, seg := range s.segments {
+		if closeErr := seg.file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	s.segments = nil
+
+	return err
+}
+
+func encodeFrame(f frame) ([]byte, error) {
+	payload, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[headerSize:], payload)
+	return buf, nil
+}
+
+// readFrame reads the frame at offset of a file of the given size
+// and returns it along with its size. It returns io.EOF if the offset
+// is at the end of the file.
+func readFrame(file *os.File, offset, fileSize int64) (frame, int64, error) {
+	if offset >= fileSize {
+		return frame{}, 0, io.EOF
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := file.ReadAt(header, offset); err != nil {
+		return frame{}, 0, fmt.Errorf("torn header: %w", err)
+	}
+
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if offset+headerSize+length > fileSize {
+		return frame{}, 0, errors.New("torn payload")
+	}
+
+	payload := make([]byte, length)
+	if _, err := file.ReadAt(payload, offset+headerSize); err != nil {
+		return frame{}, 0, fmt.Errorf("torn payload: %w", err)
+	}
+
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return frame{}, 0, errors.New("checksum mismatch")
+	}
+
+	var f frame
+	if err := json.Unmarshal(payload, &f); err != nil {
+		return frame{}, 0, err
+	}
+
+	return f, int64(headerSize + len(payload)), nil
+}
+
+// syncDir makes creation of files in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
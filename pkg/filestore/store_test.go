@@ -0,0 +1,209 @@
+package filestore_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/filestore"
+	"github.com/krixlion/dev-forum_article/pkg/storagetest"
+)
+
+func TestStoreContract(t *testing.T) {
+	storagetest.TestEventStore(t, func(t *testing.T) storagetest.EventStore {
+		store, err := filestore.Open(t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to open store, err: %v", err)
+		}
+		return store
+	})
+}
+
+func TestSnapshotsContract(t *testing.T) {
+	storagetest.TestSnapshotStore(t, func(t *testing.T) cmd.SnapshotStore {
+		snapshots, err := filestore.OpenSnapshots(t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to open snapshots, err: %v", err)
+		}
+		return snapshots
+	})
+}
+
+func TestAppendAndReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// A tiny segment size makes every append start a new segment.
+	store, err := filestore.Open(dir, filestore.WithSegmentSize(1))
+	if err != nil {
+		t.Fatalf("Failed to open store, err: %v", err)
+	}
+
+	for i := int64(0); i < 3; i++ {
+		if _, err := store.Append(ctx, "a", i, []cmd.Event{{Type: "created", Data: []byte{byte(i)}}}); err != nil {
+			t.Fatalf("Failed to append, err: %v", err)
+		}
+	}
+	if _, err := store.Append(ctx, "b", 0, []cmd.Event{{Type: "x"}, {Type: "y"}}); err != nil {
+		t.Fatalf("Failed to append, err: %v", err)
+	}
+
+	_, err = store.Append(ctx, "a", 1, []cmd.Event{{Type: "stale"}})
+	if !errors.Is(err, entity.ErrConflict) {
+		t.Fatalf("Stale append was not rejected, err: %v", err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close store, err: %v", err)
+	}
+
+	store, err = filestore.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store, err: %v", err)
+	}
+	defer store.Close()
+
+	events, err := store.Load(ctx, "a", 2)
+	if err != nil {
+		t.Fatalf("Failed to load, err: %v", err)
+	}
+	if len(events) != 2 || events[0].Version != 2 || events[1].Data[0] != 2 {
+		t.Fatalf("Unexpected events: %+v", events)
+	}
+
+	appended, err := store.Append(ctx, "b", 2, []cmd.Event{{Type: "z"}})
+	if err != nil {
+		t.Fatalf("Failed to append after reopening, err: %v", err)
+	}
+	if appended[0].Version != 3 || appended[0].Position != 6 {
+		t.Fatalf("Unexpected version or position: %+v", appended[0])
+	}
+}
+
+func TestTornFrameIsTruncated(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := filestore.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store, err: %v", err)
+	}
+	if _, err := store.Append(ctx, "a", 0, []cmd.Event{{Type: "created"}}); err != nil {
+		t.Fatalf("Failed to append, err: %v", err)
+	}
+	store.Close()
+
+	// Simulate a crash in the middle of writing the next frame.
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	file, err := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open segment, err: %v", err)
+	}
+	file.Write([]byte{0, 0, 1, 0, 42})
+	file.Close()
+
+	store, err = filestore.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store, err: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Append(ctx, "a", 1, []cmd.Event{{Type: "renamed"}}); err != nil {
+		t.Fatalf("Failed to append after recovery, err: %v", err)
+	}
+
+	events, err := store.Load(ctx, "a", 1)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("Unexpected events: %+v, err: %v", events, err)
+	}
+}
+
+func TestOutboxSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := filestore.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store, err: %v", err)
+	}
+
+	if _, err := store.Append(ctx, "a", 0, []cmd.Event{{Id: "1"}, {Id: "2"}, {Id: "3"}}); err != nil {
+		t.Fatalf("Failed to append, err: %v", err)
+	}
+	if err := store.MarkSent(ctx, 2); err != nil {
+		t.Fatalf("Failed to mark events as sent, err: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close store, err: %v", err)
+	}
+
+	store, err = filestore.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store, err: %v", err)
+	}
+	defer store.Close()
+
+	unsent, err := store.Unsent(ctx, 10)
+	if err != nil {
+		t.Fatalf("Failed to read the outbox, err: %v", err)
+	}
+	if len(unsent) != 1 || unsent[0].Id != "3" || unsent[0].Position != 3 {
+		t.Fatalf("Unexpected unsent events: %+v", unsent)
+	}
+}
+
+func TestScrubOverwritesSegments(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := filestore.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store, err: %v", err)
+	}
+
+	if _, err := store.Append(ctx, "a", 0, []cmd.Event{{Type: "created", Data: []byte("secret")}, {Type: "renamed", Data: []byte("kept")}}); err != nil {
+		t.Fatalf("Failed to append, err: %v", err)
+	}
+	if _, err := store.AppendAndScrub(ctx, "a", 2, []cmd.Event{{Type: "purged"}}, map[int64][]byte{1: nil}); err != nil {
+		t.Fatalf("Failed to append and scrub, err: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close store, err: %v", err)
+	}
+
+	// Data is base64 encoded in frames.
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	for _, segment := range segments {
+		buf, err := os.ReadFile(segment)
+		if err != nil {
+			t.Fatalf("Failed to read segment, err: %v", err)
+		}
+		if bytes.Contains(buf, []byte(base64.StdEncoding.EncodeToString([]byte("secret")))) {
+			t.Fatalf("Scrubbed data is left in %s", segment)
+		}
+	}
+
+	store, err = filestore.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store, err: %v", err)
+	}
+	defer store.Close()
+
+	events, err := store.Load(ctx, "a", 1)
+	if err != nil {
+		t.Fatalf("Failed to load, err: %v", err)
+	}
+	if len(events) != 3 || len(events[0].Data) != 0 || string(events[1].Data) != "kept" || events[2].Type != "purged" {
+		t.Fatalf("Unexpected events: %+v", events)
+	}
+
+	if _, err := store.Append(ctx, "a", 3, []cmd.Event{{Type: "published"}}); err != nil {
+		t.Fatalf("Failed to append after scrubbing, err: %v", err)
+	}
+}
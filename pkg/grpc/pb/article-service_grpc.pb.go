@@ -25,7 +25,16 @@ type ArticleServiceClient interface {
 	Create(ctx context.Context, in *CreateArticleRequest, opts ...grpc.CallOption) (*CreateArticleResponse, error)
 	Update(ctx context.Context, in *UpdateArticleRequest, opts ...grpc.CallOption) (*UpdateArticleResponse, error)
 	Get(ctx context.Context, in *GetArticleRequest, opts ...grpc.CallOption) (*GetArticleResponse, error)
+	// ListArticles pages through articles matching the filter.
+	ListArticles(ctx context.Context, in *ListArticlesRequest, opts ...grpc.CallOption) (*ListArticlesResponse, error)
+	// GetStream sends the current article followed by every change
+	// made to it until the client cancels the call.
 	GetStream(ctx context.Context, in *GetArticleRequest, opts ...grpc.CallOption) (ArticleService_GetStreamClient, error)
+	// Delete hides the article and keeps it as a tombstone
+	// until the retention period passes.
+	Delete(ctx context.Context, in *DeleteArticleRequest, opts ...grpc.CallOption) (*DeleteArticleResponse, error)
+	// Restore brings back an article deleted within the retention period.
+	Restore(ctx context.Context, in *RestoreArticleRequest, opts ...grpc.CallOption) (*RestoreArticleResponse, error)
 }
 
 type articleServiceClient struct {
@@ -63,6 +72,15 @@ func (c *articleServiceClient) Get(ctx context.Context, in *GetArticleRequest, o
 	return out, nil
 }
 
+func (c *articleServiceClient) ListArticles(ctx context.Context, in *ListArticlesRequest, opts ...grpc.CallOption) (*ListArticlesResponse, error) {
+	out := new(ListArticlesResponse)
+	err := c.cc.Invoke(ctx, "/ArticleService/ListArticles", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *articleServiceClient) GetStream(ctx context.Context, in *GetArticleRequest, opts ...grpc.CallOption) (ArticleService_GetStreamClient, error) {
 	stream, err := c.cc.NewStream(ctx, &ArticleService_ServiceDesc.Streams[0], "/ArticleService/GetStream", opts...)
 	if err != nil {
@@ -79,7 +97,7 @@ func (c *articleServiceClient) GetStream(ctx context.Context, in *GetArticleRequ
 }
 
 type ArticleService_GetStreamClient interface {
-	Recv() (*Article, error)
+	Recv() (*ArticleChange, error)
 	grpc.ClientStream
 }
 
@@ -87,14 +105,32 @@ type articleServiceGetStreamClient struct {
 	grpc.ClientStream
 }
 
-func (x *articleServiceGetStreamClient) Recv() (*Article, error) {
-	m := new(Article)
+func (x *articleServiceGetStreamClient) Recv() (*ArticleChange, error) {
+	m := new(ArticleChange)
 	if err := x.ClientStream.RecvMsg(m); err != nil {
 		return nil, err
 	}
 	return m, nil
 }
 
+func (c *articleServiceClient) Delete(ctx context.Context, in *DeleteArticleRequest, opts ...grpc.CallOption) (*DeleteArticleResponse, error) {
+	out := new(DeleteArticleResponse)
+	err := c.cc.Invoke(ctx, "/ArticleService/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *articleServiceClient) Restore(ctx context.Context, in *RestoreArticleRequest, opts ...grpc.CallOption) (*RestoreArticleResponse, error) {
+	out := new(RestoreArticleResponse)
+	err := c.cc.Invoke(ctx, "/ArticleService/Restore", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ArticleServiceServer is the server API for ArticleService service.
 // All implementations must embed UnimplementedArticleServiceServer
 // for forward compatibility
@@ -102,7 +138,16 @@ type ArticleServiceServer interface {
 	Create(context.Context, *CreateArticleRequest) (*CreateArticleResponse, error)
 	Update(context.Context, *UpdateArticleRequest) (*UpdateArticleResponse, error)
 	Get(context.Context, *GetArticleRequest) (*GetArticleResponse, error)
+	// ListArticles pages through articles matching the filter.
+	ListArticles(context.Context, *ListArticlesRequest) (*ListArticlesResponse, error)
+	// GetStream sends the current article followed by every change
+	// made to it until the client cancels the call.
 	GetStream(*GetArticleRequest, ArticleService_GetStreamServer) error
+	// Delete hides the article and keeps it as a tombstone
+	// until the retention period passes.
+	Delete(context.Context, *DeleteArticleRequest) (*DeleteArticleResponse, error)
+	// Restore brings back an article deleted within the retention period.
+	Restore(context.Context, *RestoreArticleRequest) (*RestoreArticleResponse, error)
 	mustEmbedUnimplementedArticleServiceServer()
 }
 
@@ -119,9 +164,18 @@ func (UnimplementedArticleServiceServer) Update(context.Context, *UpdateArticleR
 func (UnimplementedArticleServiceServer) Get(context.Context, *GetArticleRequest) (*GetArticleResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
 }
+func (UnimplementedArticleServiceServer) ListArticles(context.Context, *ListArticlesRequest) (*ListArticlesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListArticles not implemented")
+}
 func (UnimplementedArticleServiceServer) GetStream(*GetArticleRequest, ArticleService_GetStreamServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetStream not implemented")
 }
+func (UnimplementedArticleServiceServer) Delete(context.Context, *DeleteArticleRequest) (*DeleteArticleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedArticleServiceServer) Restore(context.Context, *RestoreArticleRequest) (*RestoreArticleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Restore not implemented")
+}
 func (UnimplementedArticleServiceServer) mustEmbedUnimplementedArticleServiceServer() {}
 
 // UnsafeArticleServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -189,6 +243,24 @@ func _ArticleService_Get_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ArticleService_ListArticles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListArticlesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ArticleServiceServer).ListArticles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ArticleService/ListArticles",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ArticleServiceServer).ListArticles(ctx, req.(*ListArticlesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _ArticleService_GetStream_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(GetArticleRequest)
 	if err := stream.RecvMsg(m); err != nil {
@@ -198,7 +270,7 @@ func _ArticleService_GetStream_Handler(srv interface{}, stream grpc.ServerStream
 }
 
 type ArticleService_GetStreamServer interface {
-	Send(*Article) error
+	Send(*ArticleChange) error
 	grpc.ServerStream
 }
 
@@ -206,10 +278,46 @@ type articleServiceGetStreamServer struct {
 	grpc.ServerStream
 }
 
-func (x *articleServiceGetStreamServer) Send(m *Article) error {
+func (x *articleServiceGetStreamServer) Send(m *ArticleChange) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _ArticleService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteArticleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ArticleServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ArticleService/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ArticleServiceServer).Delete(ctx, req.(*DeleteArticleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ArticleService_Restore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreArticleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ArticleServiceServer).Restore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ArticleService/Restore",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ArticleServiceServer).Restore(ctx, req.(*RestoreArticleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ArticleService_ServiceDesc is the grpc.ServiceDesc for ArticleService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -229,6 +337,18 @@ var ArticleService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Get",
 			Handler:    _ArticleService_Get_Handler,
 		},
+		{
+			MethodName: "ListArticles",
+			Handler:    _ArticleService_ListArticles_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _ArticleService_Delete_Handler,
+		},
+		{
+			MethodName: "Restore",
+			Handler:    _ArticleService_Restore_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
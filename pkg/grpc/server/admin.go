@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+
+	"github.com/krixlion/dev-forum_article/pkg/grpc/pb"
+	"github.com/krixlion/dev-forum_article/pkg/query"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// AdminServer implements maintenance RPCs. It does no authentication,
+// so it must be served on a listener only reachable by operators
+// of the service, never next to the ArticleServer.
+type AdminServer struct {
+	pb.UnimplementedAdminServiceServer
+	projections *query.Projections
+}
+
+func NewAdminServer(projections *query.Projections) AdminServer {
+	return AdminServer{
+		projections: projections,
+	}
+}
+
+func (srv AdminServer) RebuildProjections(req *pb.RebuildProjectionsRequest, stream pb.AdminService_RebuildProjectionsServer) error {
+	var sendErr error
+	progress := func(p query.Progress) {
+		if sendErr != nil {
+			return
+		}
+		sendErr = stream.Send(&pb.RebuildProgress{
+			Projection: p.Projection,
+			Position:   p.Position,
+			Head:       p.Head,
+			Done:       p.Done,
+		})
+	}
+
+	if err := srv.projections.Rebuild(stream.Context(), req.GetProjections(), progress); err != nil {
+		return toStatus(err)
+	}
+
+	return toStatus(sendErr)
+}
+
+func (srv AdminServer) ListDeadLetters(ctx context.Context, req *pb.ListDeadLettersRequest) (*pb.ListDeadLettersResponse, error) {
+	letters, err := srv.projections.DeadLetters(ctx, req.GetProjections())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &pb.ListDeadLettersResponse{
+		DeadLetters: make([]*pb.DeadLetter, 0, len(letters)),
+	}
+	for _, letter := range letters {
+		resp.DeadLetters = append(resp.DeadLetters, &pb.DeadLetter{
+			Projection:  letter.Projection,
+			EventId:     letter.Event.Id,
+			AggregateId: letter.Event.AggregateId,
+			Version:     letter.Event.Version,
+			Position:    letter.Event.Position,
+			Type:        letter.Event.Type,
+			Error:       letter.Err,
+			Attempts:    int32(letter.Attempts),
+			FailedAt:    timestamppb.New(letter.FailedAt),
+		})
+	}
+
+	return resp, nil
+}
+
+func (srv AdminServer) ReplayDeadLetters(ctx context.Context, req *pb.ReplayDeadLettersRequest) (*pb.ReplayDeadLettersResponse, error) {
+	replayed, err := srv.projections.ReplayDeadLetters(ctx, req.GetProjections(), req.GetAggregateIds())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &pb.ReplayDeadLettersResponse{
+		Replayed: int64(replayed),
+	}, nil
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/log"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// errorDomain is reported in errdetails.ErrorInfo.
+const errorDomain = "dev-forum_article"
+
+var kindCodes = map[entity.Kind]codes.Code{
+	entity.KindNotFound:         codes.NotFound,
+	entity.KindAlreadyExists:    codes.AlreadyExists,
+	entity.KindInvalidArgument:  codes.InvalidArgument,
+	entity.KindPermissionDenied: codes.PermissionDenied,
+	entity.KindConflict:         codes.Aborted,
+}
+
+// toStatus converts err into a gRPC status error.
+// Errors which are not part of the domain taxonomy are logged
+// and reported as Internal without leaking their message.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var domainErr *entity.Error
+	if !errors.As(err, &domainErr) {
+		log.PrintLn("transport", "grpc", "msg", "unexpected error", "err", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	code, ok := kindCodes[domainErr.Kind]
+	if !ok {
+		code = codes.Unknown
+	}
+
+	st := status.New(code, domainErr.Message)
+
+	details := []protoadapt.MessageV1{
+		&errdetails.ErrorInfo{
+			Reason:   domainErr.Reason,
+			Domain:   errorDomain,
+			Metadata: domainErr.Metadata,
+		},
+	}
+
+	if len(domainErr.Violations) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, v := range domainErr.Violations {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Description,
+			})
+		}
+		details = append(details, badRequest)
+	}
+
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
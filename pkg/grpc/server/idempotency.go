@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/idempotency"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultIdempotencyTTL is how long responses are kept for retries.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// idempotencyHeader is the metadata key used when the request field is empty.
+const idempotencyHeader = "idempotency-key"
+
+type keyedRequest interface {
+	proto.Message
+	GetIdempotencyKey() string
+}
+
+// idempotent runs fn at most once per idempotency key carried by req.
+// Requests without a key are always executed.
+func idempotent[T proto.Message](ctx context.Context, store *idempotency.Store, method string, req keyedRequest, fn func() (T, error)) (T, error) {
+	key := idempotencyKey(ctx, req)
+	if key == "" {
+		return fn()
+	}
+
+	var zero T
+	fingerprint, err := requestFingerprint(method, req)
+	if err != nil {
+		return zero, err
+	}
+
+	resp, err := store.Do(ctx, key, fingerprint, func() (proto.Message, error) {
+		return fn()
+	})
+	if errors.Is(err, idempotency.ErrPayloadMismatch) {
+		return zero, entity.InvalidArgument(entity.FieldViolation{Field: "idempotency_key", Description: err.Error()})
+	}
+	if err != nil {
+		return zero, err
+	}
+
+	return resp.(T), nil
+}
+
+func idempotencyKey(ctx context.Context, req keyedRequest) string {
+	if key := req.GetIdempotencyKey(); key != "" {
+		return key
+	}
+	return incomingHeader(ctx, idempotencyHeader)
+}
+
+// requestFingerprint hashes the method and the request without its key,
+// so that a key sent in metadata and in the request body are equivalent.
+func requestFingerprint(method string, req keyedRequest) ([]byte, error) {
+	msg := proto.Clone(req)
+	fields := msg.ProtoReflect()
+	if fd := fields.Descriptor().Fields().ByName("idempotency_key"); fd != nil {
+		fields.Clear(fd)
+	}
+
+	payload, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.New()
+	sum.Write([]byte(method))
+	sum.Write([]byte{0})
+	sum.Write(payload)
+	return sum.Sum(nil), nil
+}
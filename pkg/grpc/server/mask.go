@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/grpc/pb"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// mutableField applies a field selected by an update
+// mask path from the request to the stored article.
+type mutableField struct {
+	path  string
+	apply func(dst *entity.Article, src *pb.Article, now time.Time) error
+}
+
+// mutableFields are ordered the way they are applied
+// when the update mask is empty.
+var mutableFields = []mutableField{
+	{path: "title", apply: func(dst *entity.Article, src *pb.Article, now time.Time) error {
+		return dst.Rename(src.GetTitle(), now)
+	}},
+	{path: "body", apply: func(dst *entity.Article, src *pb.Article, now time.Time) error {
+		return dst.EditBody(src.GetBody(), now)
+	}},
+	{path: "tags", apply: func(dst *entity.Article, src *pb.Article, now time.Time) error {
+		return dst.Retag(src.GetTags(), now)
+	}},
+}
+
+func isMutable(path string) bool {
+	for _, field := range mutableFields {
+		if field.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+var immutableFields = map[string]bool{
+	"id":           true,
+	"user_id":      true,
+	"version":      true,
+	"created_at":   true,
+	"updated_at":   true,
+	"published_at": true,
+}
+
+// updatePaths validates the mask and returns its normalized paths.
+// An empty mask selects every mutable field.
+func updatePaths(mask *fieldmaskpb.FieldMask) ([]string, error) {
+	if len(mask.GetPaths()) == 0 {
+		paths := make([]string, 0, len(mutableFields))
+		for _, field := range mutableFields {
+			paths = append(paths, field.path)
+		}
+		return paths, nil
+	}
+
+	var violations []entity.FieldViolation
+	for _, path := range mask.GetPaths() {
+		switch {
+		case immutableFields[path]:
+			violations = append(violations, entity.FieldViolation{
+				Field:       "update_mask",
+				Description: fmt.Sprintf("%q is immutable", path),
+			})
+		case !isMutable(path):
+			violations = append(violations, entity.FieldViolation{
+				Field:       "update_mask",
+				Description: fmt.Sprintf("%q is not a known field", path),
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return nil, entity.InvalidArgument(violations...)
+	}
+
+	normalized := proto.Clone(mask).(*fieldmaskpb.FieldMask)
+	normalized.Normalize()
+	return normalized.GetPaths(), nil
+}
+
+// applyMask applies the fields selected by paths from src to dst
+// in the order of mutableFields, whatever the order of paths.
+// Paths must have been validated with updatePaths.
+func applyMask(dst *entity.Article, src *pb.Article, paths []string, now time.Time) error {
+	selected := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		selected[path] = true
+	}
+
+	for _, field := range mutableFields {
+		if !selected[field.path] {
+			continue
+		}
+		if err := field.apply(dst, src, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
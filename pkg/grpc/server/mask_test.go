@@ -0,0 +1,46 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/grpc/pb"
+
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestMaskAppliesFieldsInFixedOrder(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	src := &pb.Article{Title: "renamed", Body: "edited", Tags: []string{"db"}}
+
+	for _, mask := range []*fieldmaskpb.FieldMask{nil, {Paths: []string{"tags", "body", "title"}}} {
+		paths, err := updatePaths(mask)
+		if err != nil {
+			t.Fatalf("Failed to validate mask %v, err: %v", mask, err)
+		}
+
+		// Map iteration would shuffle the events of an empty mask.
+		for i := 0; i < 10; i++ {
+			article, err := entity.NewArticle("a", "user", "title", "body", []string{"go"}, now)
+			if err != nil {
+				t.Fatalf("Failed to create article, err: %v", err)
+			}
+			article.ClearEvents()
+
+			if err := applyMask(&article, src, paths, now); err != nil {
+				t.Fatalf("Failed to apply mask %v, err: %v", mask, err)
+			}
+
+			want := []entity.Event{
+				entity.ArticleTitleChanged{ArticleId: "a", Title: "renamed", At: now},
+				entity.ArticleBodyEdited{ArticleId: "a", Body: "edited", At: now},
+				entity.ArticleTagsChanged{ArticleId: "a", Tags: []string{"db"}, At: now},
+			}
+			if !reflect.DeepEqual(article.Events(), want) {
+				t.Fatalf("Unexpected events for mask %v: %+v", mask, article.Events())
+			}
+		}
+	}
+}
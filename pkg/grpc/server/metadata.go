@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/idgen"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Headers tying events to requests which caused them, possibly across services.
+const (
+	correlationHeader = "x-correlation-id"
+	causationHeader   = "x-causation-id"
+)
+
+// withEventMetadata attaches metadata of events saved on behalf of the request.
+// Requests without a correlation ID start a new correlation.
+func withEventMetadata(ctx context.Context) context.Context {
+	meta := cmd.EventMetadata{
+		CorrelationId: incomingHeader(ctx, correlationHeader),
+		CausationId:   incomingHeader(ctx, causationHeader),
+	}
+
+	if meta.CorrelationId == "" {
+		meta.CorrelationId = idgen.ULIDGenerator{}.NewID()
+	}
+
+	return cmd.ContextWithEventMetadata(ctx, meta)
+}
+
+// incomingHeader returns the first value of the request metadata key.
+func incomingHeader(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -2,30 +2,606 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
 
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
 	"github.com/krixlion/dev-forum_article/pkg/grpc/pb"
+	"github.com/krixlion/dev-forum_article/pkg/idempotency"
+	"github.com/krixlion/dev-forum_article/pkg/idgen"
+	"github.com/krixlion/dev-forum_article/pkg/notify"
+	"github.com/krixlion/dev-forum_article/pkg/query"
+	"github.com/krixlion/dev-forum_article/pkg/validation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
+// DefaultTombstoneRetention is how long deleted articles can be restored.
+const DefaultTombstoneRetention = 30 * 24 * time.Hour
+
+// DefaultConsistencyTimeout is how long reads wait for the read model
+// to reflect the write of a consistency token.
+const DefaultConsistencyTimeout = 5 * time.Second
+
+// streamBuffer is how many changes a slow GetStream client
+// can fall behind before the oldest ones are dropped.
+const streamBuffer = 16
+
 type ArticleServer struct {
 	pb.UnimplementedArticleServiceServer
+	cmdStorage   cmd.Storage
+	queryStorage query.Storage
+	retention    time.Duration
+	hub          *notify.Hub
+	idGenerator  idgen.IDGenerator
+	idempotency  *idempotency.Store
+	clock        clock.Clock
+	validator    validation.Validator
+	history      cmd.History
+	waiter       query.Waiter
+	// consistencyTimeout bounds waits for consistency tokens.
+	consistencyTimeout time.Duration
+	// idempotencyTTL is how long responses are kept for retries.
+	idempotencyTTL time.Duration
+	// importMode allows clients to choose IDs of created articles.
+	importMode bool
+}
+
+type Option func(*ArticleServer)
+
+// WithTombstoneRetention sets how long deleted articles can be restored.
+func WithTombstoneRetention(retention time.Duration) Option {
+	return func(srv *ArticleServer) {
+		srv.retention = retention
+	}
+}
+
+// WithIDGenerator sets the generator of IDs assigned to created articles.
+func WithIDGenerator(generator idgen.IDGenerator) Option {
+	return func(srv *ArticleServer) {
+		srv.idGenerator = generator
+	}
+}
+
+// WithClock sets the source of timestamps assigned to articles.
+func WithClock(clock clock.Clock) Option {
+	return func(srv *ArticleServer) {
+		srv.clock = clock
+	}
+}
+
+// WithValidationRules sets the limits enforced on titles and bodies.
+func WithValidationRules(rules validation.Rules) Option {
+	return func(srv *ArticleServer) {
+		srv.validator = validation.NewValidator(rules)
+	}
+}
+
+// WithHistory enables reads of past states of articles.
+func WithHistory(history cmd.History) Option {
+	return func(srv *ArticleServer) {
+		srv.history = history
+	}
+}
+
+// WithConsistency makes reads carrying a consistency token wait
+// at most timeout for the waiter to reflect the token's write.
+func WithConsistency(waiter query.Waiter, timeout time.Duration) Option {
+	return func(srv *ArticleServer) {
+		srv.waiter = waiter
+		srv.consistencyTimeout = timeout
+	}
+}
+
+// WithImportMode makes Create keep IDs supplied by clients, which is
+// needed when importing existing articles. Articles without an ID
+// are still assigned a generated one.
+func WithImportMode(enabled bool) Option {
+	return func(srv *ArticleServer) {
+		srv.importMode = enabled
+	}
+}
+
+// WithIdempotencyTTL sets how long responses to requests carrying
+// an idempotency key are kept for retries. Every replica keeps
+// its own responses, see package idempotency.
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(srv *ArticleServer) {
+		srv.idempotencyTTL = ttl
+	}
+}
+
+func NewArticleServer(cmdStorage cmd.Storage, queryStorage query.Storage, opts ...Option) ArticleServer {
+	srv := ArticleServer{
+		cmdStorage:   cmdStorage,
+		queryStorage: queryStorage,
+		retention:    DefaultTombstoneRetention,
+		hub:          notify.NewHub(),
+		idGenerator:  idgen.ULIDGenerator{},
+		clock:        clock.System{},
+		validator:    validation.NewValidator(validation.DefaultRules()),
+
+		consistencyTimeout: DefaultConsistencyTimeout,
+		idempotencyTTL:     DefaultIdempotencyTTL,
+	}
+
+	for _, opt := range opts {
+		opt(&srv)
+	}
+
+	// Built last to share the clock set by the options.
+	srv.idempotency = idempotency.NewStore(srv.idempotencyTTL, idempotency.WithClock(srv.clock))
+
+	return srv
 }
 
 func (srv ArticleServer) Close(context.Context) error {
-	panic("Unimplemented method")
+	if err := srv.cmdStorage.Close(); err != nil {
+		return err
+	}
+	return srv.queryStorage.Close()
+}
+
+func (srv ArticleServer) Create(ctx context.Context, req *pb.CreateArticleRequest) (*pb.CreateArticleResponse, error) {
+	resp, err := idempotent(ctx, srv.idempotency, "Create", req, func() (*pb.CreateArticleResponse, error) {
+		return srv.create(withEventMetadata(ctx), req)
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return resp, nil
+}
+
+func (srv ArticleServer) create(ctx context.Context, req *pb.CreateArticleRequest) (*pb.CreateArticleResponse, error) {
+	if req.GetArticle() == nil {
+		return nil, entity.InvalidArgument(entity.FieldViolation{Field: "article", Description: "must be set"})
+	}
+
+	src, contentViolations := srv.normalizeContent(req.GetArticle(), []string{"title", "body"})
+
+	id := src.GetId()
+	if id == "" {
+		id = srv.idGenerator.NewID()
+	}
+
+	now := srv.clock.Now()
+	article, err := entity.NewArticle(id, src.GetUserId(), src.GetTitle(), src.GetBody(), src.GetTags(), now)
+
+	// Report violations of the request and of the domain invariants at once.
+	violations := append(srv.idViolations(src), contentViolations...)
+	if len(violations) > 0 {
+		return nil, entity.InvalidArgument(mergeViolations(violations, entity.Violations(err))...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Articles are published as soon as they are created.
+	if err := article.Publish(now); err != nil {
+		return nil, err
+	}
+
+	ctx, receipt := cmd.ContextWithReceipt(ctx)
+	article, err = srv.cmdStorage.Create(ctx, article)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := entity.ArticleToPB(article)
+	srv.hub.Publish(notify.Change{Type: notify.Created, Article: msg})
+
+	return &pb.CreateArticleResponse{
+		Article:          msg,
+		ConsistencyToken: consistencyToken(receipt),
+	}, nil
+}
+
+func (srv ArticleServer) Update(ctx context.Context, req *pb.UpdateArticleRequest) (*pb.UpdateArticleResponse, error) {
+	resp, err := idempotent(ctx, srv.idempotency, "Update", req, func() (*pb.UpdateArticleResponse, error) {
+		return srv.update(withEventMetadata(ctx), req)
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return resp, nil
 }
 
-func (srv ArticleServer) Create(_ context.Context, _ *pb.CreateArticleRequest) (*pb.CreateArticleResponse, error) {
-	panic("not implemented") // TODO: Implement
+func (srv ArticleServer) update(ctx context.Context, req *pb.UpdateArticleRequest) (*pb.UpdateArticleResponse, error) {
+	if req.GetArticle() == nil {
+		return nil, entity.InvalidArgument(entity.FieldViolation{Field: "article", Description: "must be set"})
+	}
+
+	if req.GetArticle().GetId() == "" {
+		return nil, entity.InvalidArgument(entity.FieldViolation{Field: "article.id", Description: "must not be empty"})
+	}
+
+	paths, err := updatePaths(req.GetUpdateMask())
+	if err != nil {
+		return nil, err
+	}
+
+	src, violations := srv.normalizeContent(req.GetArticle(), paths)
+	if len(violations) > 0 {
+		return nil, entity.InvalidArgument(violations...)
+	}
+
+	ctx, receipt := cmd.ContextWithReceipt(ctx)
+	article, err := srv.cmdStorage.Update(ctx, src.GetId(), func(current *entity.Article) error {
+		if expected := req.GetExpectedVersion(); expected != 0 && expected != current.Version {
+			return versionMismatch(current.Id, expected, current.Version)
+		}
+
+		return applyMask(current, src, paths, srv.clock.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msg := entity.ArticleToPB(article)
+	srv.hub.Publish(notify.Change{Type: notify.Updated, Article: msg})
+
+	return &pb.UpdateArticleResponse{
+		Article:          msg,
+		ConsistencyToken: consistencyToken(receipt),
+	}, nil
 }
 
-func (srv ArticleServer) Update(_ context.Context, _ *pb.UpdateArticleRequest) (*pb.UpdateArticleResponse, error) {
-	panic("not implemented") // TODO: Implement
+func (srv ArticleServer) Get(ctx context.Context, req *pb.GetArticleRequest) (*pb.GetArticleResponse, error) {
+	if err := validateArticleId(req.GetArticleId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	asOf, past, err := asOfParams(req)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	if past {
+		return srv.getAsOf(ctx, req.GetArticleId(), asOf)
+	}
+
+	if err := srv.awaitConsistency(ctx, req.GetConsistencyToken()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	article, err := srv.queryStorage.Get(ctx, req.GetArticleId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &pb.GetArticleResponse{
+		Article: entity.ArticleToPB(article),
+	}, nil
 }
 
-func (srv ArticleServer) Get(_ context.Context, _ *pb.GetArticleRequest) (*pb.GetArticleResponse, error) {
-	panic("not implemented") // TODO: Implement
+// getAsOf bypasses the read model, which only holds the latest state.
+func (srv ArticleServer) getAsOf(ctx context.Context, id string, asOf cmd.AsOf) (*pb.GetArticleResponse, error) {
+	if srv.history == nil {
+		return nil, status.Error(codes.Unimplemented, "reading past states of articles is not enabled")
+	}
+
+	article, err := srv.history.LoadAsOf(ctx, id, asOf)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &pb.GetArticleResponse{
+		Article: entity.ArticleToPB(article),
+	}, nil
 }
 
-func (srv ArticleServer) GetStream(_ *pb.GetArticleRequest, _ pb.ArticleService_GetStreamServer) error {
-	panic("not implemented") // TODO: Implement
+// asOfParams reports whether the request asks for a past state of the article.
+func asOfParams(req *pb.GetArticleRequest) (cmd.AsOf, bool, error) {
+	var violations []entity.FieldViolation
+	asOf := cmd.AsOf{Version: req.GetAsOfVersion()}
+
+	if req.AsOfTime != nil {
+		if err := req.GetAsOfTime().CheckValid(); err != nil {
+			violations = append(violations, entity.FieldViolation{Field: "as_of_time", Description: "must be a valid timestamp"})
+		}
+		asOf.Time = req.GetAsOfTime().AsTime()
+	}
+
+	if asOf.Version < 0 {
+		violations = append(violations, entity.FieldViolation{Field: "as_of_version", Description: "must not be negative"})
+	}
+
+	if len(violations) > 0 {
+		return cmd.AsOf{}, false, entity.InvalidArgument(violations...)
+	}
+
+	return asOf, req.AsOfTime != nil || asOf.Version > 0, nil
+}
+
+func (srv ArticleServer) ListArticles(ctx context.Context, req *pb.ListArticlesRequest) (*pb.ListArticlesResponse, error) {
+	params, err := listParams(req)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	if err := srv.awaitConsistency(ctx, req.GetConsistencyToken()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	page, err := srv.queryStorage.List(ctx, params)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &pb.ListArticlesResponse{
+		Articles: make([]*pb.Article, 0, len(page.Items)),
+	}
+	for _, article := range page.Items {
+		resp.Articles = append(resp.Articles, entity.ArticleToPB(article))
+	}
+
+	if page.Next != nil {
+		resp.NextPageToken = query.EncodePageToken(params.Filter, params.Order, *page.Next)
+	}
+
+	return resp, nil
+}
+
+// GetStream sends the current article and then every change published
+// to the hub until the client cancels the call.
+func (srv ArticleServer) GetStream(req *pb.GetArticleRequest, stream pb.ArticleService_GetStreamServer) error {
+	if err := validateArticleId(req.GetArticleId()); err != nil {
+		return toStatus(err)
+	}
+
+	if req.AsOfTime != nil || req.GetAsOfVersion() != 0 {
+		field := "as_of_time"
+		if req.AsOfTime == nil {
+			field = "as_of_version"
+		}
+		return toStatus(entity.InvalidArgument(entity.FieldViolation{Field: field, Description: "is not supported by GetStream"}))
+	}
+
+	ctx := stream.Context()
+
+	// Subscribe before reading the current state so that
+	// no change made in between is missed.
+	changes, unsubscribe := srv.hub.Subscribe(req.GetArticleId(), streamBuffer)
+	defer unsubscribe()
+
+	if err := srv.awaitConsistency(ctx, req.GetConsistencyToken()); err != nil {
+		return toStatus(err)
+	}
+
+	article, err := srv.queryStorage.Get(ctx, req.GetArticleId())
+	if err != nil {
+		return toStatus(err)
+	}
+
+	current := &pb.ArticleChange{
+		Type:    pb.ChangeType_CHANGE_TYPE_CURRENT,
+		Article: entity.ArticleToPB(article),
+	}
+	if err := stream.Send(current); err != nil {
+		return toStatus(err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return toStatus(ctx.Err())
+		case change := <-changes:
+			msg := &pb.ArticleChange{
+				Type:    changeTypes[change.Type],
+				Article: change.Article,
+			}
+			if err := stream.Send(msg); err != nil {
+				return toStatus(err)
+			}
+		}
+	}
+}
+
+func (srv ArticleServer) Delete(ctx context.Context, req *pb.DeleteArticleRequest) (*pb.DeleteArticleResponse, error) {
+	if err := validateArticleId(req.GetArticleId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	ctx, receipt := cmd.ContextWithReceipt(withEventMetadata(ctx))
+	article, err := srv.cmdStorage.Delete(ctx, req.GetArticleId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	srv.hub.Publish(notify.Change{Type: notify.Deleted, Article: entity.ArticleToPB(article)})
+
+	return &pb.DeleteArticleResponse{
+		ConsistencyToken: consistencyToken(receipt),
+	}, nil
+}
+
+func (srv ArticleServer) Restore(ctx context.Context, req *pb.RestoreArticleRequest) (*pb.RestoreArticleResponse, error) {
+	if err := validateArticleId(req.GetArticleId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	ctx, receipt := cmd.ContextWithReceipt(withEventMetadata(ctx))
+	article, err := srv.cmdStorage.Restore(ctx, req.GetArticleId(), srv.clock.Now().Add(-srv.retention))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	msg := entity.ArticleToPB(article)
+	srv.hub.Publish(notify.Change{Type: notify.Restored, Article: msg})
+
+	return &pb.RestoreArticleResponse{
+		Article:          msg,
+		ConsistencyToken: consistencyToken(receipt),
+	}, nil
+}
+
+// consistencyToken returns an empty token if nothing was written.
+func consistencyToken(receipt *cmd.Receipt) string {
+	position := receipt.Position()
+	if position == 0 {
+		return ""
+	}
+	return query.EncodeConsistencyToken(position)
+}
+
+// awaitConsistency blocks until the read model reflects the write
+// the token was issued for. It fails with Unavailable if that takes
+// longer than the consistency timeout or the deadline of the request.
+func (srv ArticleServer) awaitConsistency(ctx context.Context, token string) error {
+	position, err := query.DecodeConsistencyToken(token)
+	if err != nil || position == 0 {
+		return err
+	}
+
+	if srv.waiter == nil {
+		return status.Error(codes.Unimplemented, "consistency tokens are not supported")
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, srv.consistencyTimeout)
+	defer cancel()
+
+	err = srv.waiter.WaitFor(waitCtx, position)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.Unavailable, "the read model has not caught up with the consistency token, retry later")
+	}
+	return err
+}
+
+func versionMismatch(id string, expected, actual int64) error {
+	return entity.Conflict(
+		"VERSION_MISMATCH",
+		fmt.Sprintf("article %q is at version %d, expected %d", id, actual, expected),
+		map[string]string{
+			"article_id":       id,
+			"expected_version": strconv.FormatInt(expected, 10),
+			"actual_version":   strconv.FormatInt(actual, 10),
+		},
+	)
+}
+
+// normalizeContent validates the title and body if they are selected
+// by paths and returns a copy of the article with them normalized.
+func (srv ArticleServer) normalizeContent(article *pb.Article, paths []string) (*pb.Article, []entity.FieldViolation) {
+	normalized := proto.Clone(article).(*pb.Article)
+
+	var violations []entity.FieldViolation
+	for _, path := range paths {
+		var v []entity.FieldViolation
+		switch path {
+		case "title":
+			normalized.Title, v = srv.validator.Title(article.GetTitle())
+		case "body":
+			normalized.Body, v = srv.validator.Body(article.GetBody())
+		}
+		violations = append(violations, v...)
+	}
+
+	return normalized, violations
+}
+
+// idViolations checks that the client did not choose the ID of a new
+// article. IDs are assigned by the server unless import mode is enabled.
+func (srv ArticleServer) idViolations(article *pb.Article) []entity.FieldViolation {
+	if article.GetId() != "" && !srv.importMode {
+		return []entity.FieldViolation{{Field: "article.id", Description: "must be empty, IDs are assigned by the server"}}
+	}
+	return nil
+}
+
+// mergeViolations appends violations of fields not reported yet,
+// since the domain repeats some of the checks of the request.
+func mergeViolations(violations, more []entity.FieldViolation) []entity.FieldViolation {
+	reported := make(map[string]bool, len(violations))
+	for _, v := range violations {
+		reported[v.Field] = true
+	}
+
+	for _, v := range more {
+		if !reported[v.Field] {
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+func validateArticleId(id string) error {
+	if id == "" {
+		return entity.InvalidArgument(entity.FieldViolation{Field: "article_id", Description: "must not be empty"})
+	}
+	return nil
+}
+
+var changeTypes = map[notify.ChangeType]pb.ChangeType{
+	notify.Created:  pb.ChangeType_CHANGE_TYPE_CREATED,
+	notify.Updated:  pb.ChangeType_CHANGE_TYPE_UPDATED,
+	notify.Deleted:  pb.ChangeType_CHANGE_TYPE_DELETED,
+	notify.Restored: pb.ChangeType_CHANGE_TYPE_RESTORED,
+}
+
+var orders = map[pb.ArticleOrder]query.Order{
+	pb.ArticleOrder_ARTICLE_ORDER_UNSPECIFIED:      query.OrderNewest,
+	pb.ArticleOrder_ARTICLE_ORDER_NEWEST:           query.OrderNewest,
+	pb.ArticleOrder_ARTICLE_ORDER_OLDEST:           query.OrderOldest,
+	pb.ArticleOrder_ARTICLE_ORDER_RECENTLY_UPDATED: query.OrderRecentlyUpdated,
+}
+
+// listParams validates the request and translates it into query.ListParams.
+func listParams(req *pb.ListArticlesRequest) (query.ListParams, error) {
+	var violations []entity.FieldViolation
+
+	limit := int(req.GetPageSize())
+	switch {
+	case limit < 0:
+		violations = append(violations, entity.FieldViolation{Field: "page_size", Description: "must not be negative"})
+	case limit == 0:
+		limit = query.DefaultPageSize
+	case limit > query.MaxPageSize:
+		limit = query.MaxPageSize
+	}
+
+	order, ok := orders[req.GetOrder()]
+	if !ok {
+		violations = append(violations, entity.FieldViolation{Field: "order", Description: "is not a known order"})
+	}
+
+	filter := query.Filter{
+		UserId: req.GetFilter().GetUserId(),
+		Tag:    req.GetFilter().GetTag(),
+	}
+
+	if after := req.GetFilter().GetCreatedAfter(); after != nil {
+		if err := after.CheckValid(); err != nil {
+			violations = append(violations, entity.FieldViolation{Field: "filter.created_after", Description: err.Error()})
+		}
+		filter.CreatedAfter = after.AsTime()
+	}
+
+	if before := req.GetFilter().GetCreatedBefore(); before != nil {
+		if err := before.CheckValid(); err != nil {
+			violations = append(violations, entity.FieldViolation{Field: "filter.created_before", Description: err.Error()})
+		}
+		filter.CreatedBefore = before.AsTime()
+	}
+
+	if len(violations) > 0 {
+		return query.ListParams{}, entity.InvalidArgument(violations...)
+	}
+
+	cursor, err := query.DecodePageToken(req.GetPageToken(), filter, order)
+	if err != nil {
+		return query.ListParams{}, err
+	}
+
+	return query.ListParams{
+		Filter: filter,
+		Order:  order,
+		Limit:  limit,
+		After:  cursor,
+	}, nil
 }
@@ -0,0 +1,147 @@
+// Package idempotency remembers results of requests by their
+// idempotency keys so that retries can be answered without
+// executing them again.
+//
+// Keys are kept in the memory of the process and are not shared
+// between replicas of the service. When it runs as several replicas,
+// the load balancer has to route requests carrying the same key to
+// the same replica, e.g. by hashing the idempotency-key header.
+// Otherwise a retry reaching another replica is executed again.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrPayloadMismatch is returned when a key is reused for a different request.
+var ErrPayloadMismatch = errors.New("idempotency key was used with a different request")
+
+type entry struct {
+	fingerprint []byte
+	response    proto.Message
+	expiresAt   time.Time
+	// done is closed once the first request holding the key finishes.
+	done chan struct{}
+	// failed is set when the first request failed and the key was released.
+	failed bool
+}
+
+// Store keeps successful responses in memory for the TTL.
+// It is safe for concurrent use.
+type Store struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	clock     clock.Clock
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+type Option func(*Store)
+
+// WithClock sets the source of the time entries expire at.
+func WithClock(clock clock.Clock) Option {
+	return func(s *Store) {
+		s.clock = clock
+	}
+}
+
+func NewStore(ttl time.Duration, opts ...Option) *Store {
+	s := &Store{
+		ttl:     ttl,
+		clock:   clock.System{},
+		entries: make(map[string]*entry),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Do executes fn unless a response for the key is already stored,
+// in which case a copy of it is returned instead. The fingerprint
+// identifies the request the key was first used with. Concurrent calls
+// with the same key wait for the first one to finish. Failed calls
+// are not remembered so that they can be retried.
+func (s *Store) Do(ctx context.Context, key string, fingerprint []byte, fn func() (proto.Message, error)) (proto.Message, error) {
+	for {
+		s.mu.Lock()
+		now := s.clock.Now()
+		s.sweep(now)
+
+		e, ok := s.entries[key]
+		if !ok || e.expired(now) {
+			e = &entry{
+				fingerprint: fingerprint,
+				done:        make(chan struct{}),
+			}
+			s.entries[key] = e
+			s.mu.Unlock()
+			return s.execute(key, e, fn)
+		}
+		s.mu.Unlock()
+
+		if !bytes.Equal(e.fingerprint, fingerprint) {
+			return nil, ErrPayloadMismatch
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-e.done:
+		}
+
+		if !e.failed {
+			return proto.Clone(e.response), nil
+		}
+		// The first attempt failed and released the key, try to claim it.
+	}
+}
+
+func (s *Store) execute(key string, e *entry, fn func() (proto.Message, error)) (proto.Message, error) {
+	response, err := fn()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer close(e.done)
+
+	if err != nil {
+		e.failed = true
+		delete(s.entries, key)
+		return nil, err
+	}
+
+	e.response = proto.Clone(response)
+	e.expiresAt = s.clock.Now().Add(s.ttl)
+	return response, nil
+}
+
+// sweep drops expired entries at most once per TTL.
+// It must be called with s.mu held.
+func (s *Store) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	s.lastSweep = now
+
+	for key, e := range s.entries {
+		if e.expired(now) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// expired reports whether the response of the entry is no longer kept.
+// Entries of requests in flight never expire.
+func (e *entry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
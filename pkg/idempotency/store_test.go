@@ -0,0 +1,69 @@
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/idempotency"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// manualClock only moves when it is told to.
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestResponsesExpireAfterTTL(t *testing.T) {
+	ctx := context.Background()
+	clock := &manualClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := idempotency.NewStore(time.Hour, idempotency.WithClock(clock))
+
+	calls := 0
+	do := func(fingerprint string) (proto.Message, error) {
+		return store.Do(ctx, "key", []byte(fingerprint), func() (proto.Message, error) {
+			calls++
+			return wrapperspb.Int64(int64(calls)), nil
+		})
+	}
+
+	first, err := do("request")
+	if err != nil {
+		t.Fatalf("Failed to execute, err: %v", err)
+	}
+
+	clock.advance(time.Hour)
+	retry, err := do("request")
+	if err != nil {
+		t.Fatalf("Failed to retry, err: %v", err)
+	}
+	if calls != 1 || !proto.Equal(retry, first) {
+		t.Fatalf("Retry was executed again, calls: %v, response: %v", calls, retry)
+	}
+
+	if _, err := do("another request"); !errors.Is(err, idempotency.ErrPayloadMismatch) {
+		t.Fatalf("Key was reused for another request, err: %v", err)
+	}
+
+	clock.advance(time.Second)
+	if _, err := do("another request"); err != nil || calls != 2 {
+		t.Fatalf("Expired key was not released, calls: %v, err: %v", calls, err)
+	}
+}
@@ -0,0 +1,40 @@
+// Package idgen provides generators of article IDs.
+package idgen
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// IDGenerator returns unique IDs which sort lexicographically
+// in the order they were generated.
+type IDGenerator interface {
+	NewID() string
+}
+
+// ULIDGenerator generates ULIDs, which embed a millisecond timestamp
+// followed by entropy that increases monotonically within the millisecond.
+type ULIDGenerator struct{}
+
+func (ULIDGenerator) NewID() string {
+	return ulid.Make().String()
+}
+
+// SequenceGenerator is a deterministic IDGenerator meant for tests.
+// It yields the prefix followed by a zero-padded counter starting at 1.
+type SequenceGenerator struct {
+	prefix string
+	n      atomic.Uint64
+}
+
+func NewSequenceGenerator(prefix string) *SequenceGenerator {
+	return &SequenceGenerator{
+		prefix: prefix,
+	}
+}
+
+func (g *SequenceGenerator) NewID() string {
+	return fmt.Sprintf("%s%020d", g.prefix, g.n.Add(1))
+}
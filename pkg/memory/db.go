@@ -0,0 +1,209 @@
+// Package memory implements in-memory event stores and read models
+// meant for local runs and tests.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/query"
+)
+
+// DB is an in-memory query.ReadModel. It also implements
+// cmd.TombstoneFinder, since it keeps deleted articles until they are purged.
+type DB struct {
+	mu sync.RWMutex
+	// articles holds projected articles including tombstones.
+	// Purged articles only keep their ID and version.
+	articles   map[string]entity.Article
+	checkpoint int64
+}
+
+func NewDB() *DB {
+	return &DB{
+		articles: make(map[string]entity.Article),
+	}
+}
+
+func (db *DB) Apply(_ context.Context, event entity.Event, version, position int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	id := event.AggregateId()
+	article := db.articles[id].Clone()
+
+	if version <= article.Version {
+		db.advance(position)
+		return nil
+	}
+
+	if version != article.Version+1 {
+		return query.VersionGap(id, article.Version, version)
+	}
+
+	if err := article.Apply(event); err != nil {
+		return err
+	}
+
+	if article.Purged {
+		article = entity.Article{Id: id, Version: article.Version, Purged: true}
+	}
+
+	db.articles[id] = article
+	db.advance(position)
+	return nil
+}
+
+func (db *DB) SaveCheckpoint(_ context.Context, position int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.advance(position)
+	return nil
+}
+
+func (db *DB) Checkpoint(context.Context) (int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.checkpoint, nil
+}
+
+// advance must be called with db.mu held.
+func (db *DB) advance(position int64) {
+	if position > db.checkpoint {
+		db.checkpoint = position
+	}
+}
+
+func (db *DB) Tombstones(_ context.Context, deletedBefore time.Time) ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var ids []string
+	for id, article := range db.articles {
+		if article.IsDeleted() && !article.Purged && article.DeletedAt.Before(deletedBefore) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+func (db *DB) Get(_ context.Context, id string) (entity.Article, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	article, ok := db.articles[id]
+	if !ok || !visible(article) {
+		return entity.Article{}, entity.NotFound(id)
+	}
+
+	return article.Clone(), nil
+}
+
+// visible reports whether the article can be read by clients.
+func visible(article entity.Article) bool {
+	return !article.IsDeleted() && !article.Purged
+}
+
+func (db *DB) List(_ context.Context, params query.ListParams) (query.Page[entity.Article], error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	sortKey := func(article entity.Article) time.Time {
+		if params.Order == query.OrderRecentlyUpdated {
+			return article.UpdatedAt
+		}
+		return article.CreatedAt
+	}
+
+	matching := make([]entity.Article, 0, len(db.articles))
+	for _, article := range db.articles {
+		if !visible(article) || !matches(article, params.Filter) {
+			continue
+		}
+		if params.After != nil && !params.After.After(params.Order, sortKey(article), article.Id) {
+			continue
+		}
+		matching = append(matching, article)
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		ki, kj := sortKey(matching[i]), sortKey(matching[j])
+		if ki.Equal(kj) {
+			return matching[i].Id < matching[j].Id
+		}
+		if params.Order == query.OrderOldest {
+			return ki.Before(kj)
+		}
+		return ki.After(kj)
+	})
+
+	page := query.Page[entity.Article]{}
+	if len(matching) > params.Limit {
+		matching = matching[:params.Limit]
+		last := matching[len(matching)-1]
+		page.Next = &query.Cursor{SortKey: sortKey(last), Id: last.Id}
+	}
+
+	for _, article := range matching {
+		page.Items = append(page.Items, article.Clone())
+	}
+
+	return page, nil
+}
+
+func matches(article entity.Article, filter query.Filter) bool {
+	if filter.UserId != "" && article.UserId != filter.UserId {
+		return false
+	}
+	if filter.Tag != "" && !containsTag(article.Tags, filter.Tag) {
+		return false
+	}
+	if !filter.CreatedAfter.IsZero() && article.CreatedAt.Before(filter.CreatedAfter) {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && !article.CreatedAt.Before(filter.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *DB) Close() error {
+	return nil
+}
+
+func (db *DB) Shadow(context.Context) (query.ReadModel, error) {
+	return NewDB(), nil
+}
+
+func (db *DB) Swap(_ context.Context, shadow query.ReadModel) error {
+	s, ok := shadow.(*DB)
+	if !ok {
+		return fmt.Errorf("cannot swap in %T", shadow)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.articles, db.checkpoint = s.articles, s.checkpoint
+	s.articles, s.checkpoint = make(map[string]entity.Article), 0
+	return nil
+}
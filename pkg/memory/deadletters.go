@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/krixlion/dev-forum_article/pkg/query"
+)
+
+// DeadLetters is an in-memory query.DeadLetters. It is only meant
+// for read models kept in memory, which are projected from scratch
+// on every start and so dead-letter the same events again.
+type DeadLetters struct {
+	mu sync.Mutex
+	// letters are kept by the position of their events.
+	letters map[int64]query.DeadLetter
+}
+
+func NewDeadLetters() *DeadLetters {
+	return &DeadLetters{
+		letters: make(map[int64]query.DeadLetter),
+	}
+}
+
+func (d *DeadLetters) Add(_ context.Context, letter query.DeadLetter) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.letters[letter.Event.Position] = letter
+	return nil
+}
+
+func (d *DeadLetters) List(context.Context) ([]query.DeadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	letters := make([]query.DeadLetter, 0, len(d.letters))
+	for _, letter := range d.letters {
+		letters = append(letters, letter)
+	}
+
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].Event.Position < letters[j].Event.Position
+	})
+
+	return letters, nil
+}
+
+func (d *DeadLetters) Halted(_ context.Context, aggregateId string, position int64) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, letter := range d.letters {
+		if letter.Event.AggregateId == aggregateId && letter.Event.Position < position {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (d *DeadLetters) Remove(_ context.Context, position int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.letters, position)
+	return nil
+}
+
+func (d *DeadLetters) Shadow(context.Context, query.ReadModel) (query.DeadLetters, error) {
+	return NewDeadLetters(), nil
+}
+
+func (d *DeadLetters) Swap(_ context.Context, shadow query.DeadLetters) error {
+	s, ok := shadow.(*DeadLetters)
+	if !ok {
+		return fmt.Errorf("cannot swap in %T", shadow)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.letters, s.letters = s.letters, make(map[int64]query.DeadLetter)
+	return nil
+}
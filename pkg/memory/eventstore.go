@@ -0,0 +1,161 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+)
+
+// EventStore is an in-memory cmd.EventStore. It is also a cmd.Outbox,
+// events after the sent position are the ones waiting to be published.
+type EventStore struct {
+	mu      sync.RWMutex
+	streams map[string][]cmd.Event
+	// all holds events of every stream, events[i] is at position i+1.
+	all   []cmd.Event
+	sent  int64
+	clock clock.Clock
+}
+
+func NewEventStore(clock clock.Clock) *EventStore {
+	return &EventStore{
+		streams: make(map[string][]cmd.Event),
+		clock:   clock,
+	}
+}
+
+func (s *EventStore) Append(_ context.Context, aggregateId string, expectedVersion int64, events []cmd.Event) ([]cmd.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.append(aggregateId, expectedVersion, events)
+}
+
+func (s *EventStore) AppendAndScrub(_ context.Context, aggregateId string, expectedVersion int64, events []cmd.Event, data map[int64][]byte) ([]cmd.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version := int64(len(s.streams[aggregateId])); version != expectedVersion {
+		return nil, cmd.ConcurrencyConflict(aggregateId, expectedVersion, version)
+	}
+	for version := range data {
+		if version < 1 || version > expectedVersion {
+			return nil, fmt.Errorf("event %d of %q does not exist", version, aggregateId)
+		}
+	}
+
+	appended, err := s.append(aggregateId, expectedVersion, events)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := s.streams[aggregateId]
+	for version, d := range data {
+		event := &stream[version-1]
+		event.Data = append([]byte(nil), d...)
+		s.all[event.Position-1].Data = event.Data
+	}
+
+	return appended, nil
+}
+
+// append must be called with s.mu held.
+func (s *EventStore) append(aggregateId string, expectedVersion int64, events []cmd.Event) ([]cmd.Event, error) {
+	stream := s.streams[aggregateId]
+	if version := int64(len(stream)); version != expectedVersion {
+		return nil, cmd.ConcurrencyConflict(aggregateId, expectedVersion, version)
+	}
+
+	now := s.clock.Now()
+	appended := make([]cmd.Event, 0, len(events))
+	for i, event := range events {
+		event.AggregateId = aggregateId
+		event.Version = expectedVersion + int64(i) + 1
+		event.Position = int64(len(s.all) + i + 1)
+		event.RecordedAt = now
+		event.Data = append([]byte(nil), event.Data...)
+		appended = append(appended, event)
+	}
+
+	s.streams[aggregateId] = append(stream, appended...)
+	s.all = append(s.all, appended...)
+
+	return copyEvents(appended), nil
+}
+
+func (s *EventStore) Load(_ context.Context, aggregateId string, fromVersion int64) ([]cmd.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stream := s.streams[aggregateId]
+	if fromVersion < 1 {
+		fromVersion = 1
+	}
+	if fromVersion > int64(len(stream)) {
+		return nil, nil
+	}
+
+	return copyEvents(stream[fromVersion-1:]), nil
+}
+
+func (s *EventStore) ReadAll(_ context.Context, afterPosition int64, limit int) ([]cmd.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if afterPosition < 0 {
+		afterPosition = 0
+	}
+	if afterPosition >= int64(len(s.all)) {
+		return nil, nil
+	}
+
+	events := s.all[afterPosition:]
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return copyEvents(events), nil
+}
+
+func (s *EventStore) Head(context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return int64(len(s.all)), nil
+}
+
+func (s *EventStore) Unsent(ctx context.Context, limit int) ([]cmd.Event, error) {
+	s.mu.RLock()
+	sent := s.sent
+	s.mu.RUnlock()
+
+	return s.ReadAll(ctx, sent, limit)
+}
+
+func (s *EventStore) MarkSent(_ context.Context, position int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if position > int64(len(s.all)) {
+		return fmt.Errorf("cannot mark position %d as sent, head is at %d", position, len(s.all))
+	}
+	if position > s.sent {
+		s.sent = position
+	}
+	return nil
+}
+
+func (s *EventStore) Close() error {
+	return nil
+}
+
+func copyEvents(events []cmd.Event) []cmd.Event {
+	copied := make([]cmd.Event, len(events))
+	for i, event := range events {
+		event.Data = append([]byte(nil), event.Data...)
+		copied[i] = event
+	}
+	return copied
+}
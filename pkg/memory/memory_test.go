@@ -0,0 +1,35 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/memory"
+	"github.com/krixlion/dev-forum_article/pkg/query"
+	"github.com/krixlion/dev-forum_article/pkg/storagetest"
+)
+
+func TestEventStore(t *testing.T) {
+	storagetest.TestEventStore(t, func(*testing.T) storagetest.EventStore {
+		return memory.NewEventStore(clock.System{})
+	})
+}
+
+func TestSnapshots(t *testing.T) {
+	storagetest.TestSnapshotStore(t, func(*testing.T) cmd.SnapshotStore {
+		return memory.NewSnapshots()
+	})
+}
+
+func TestDB(t *testing.T) {
+	storagetest.TestReadModel(t, func(*testing.T) storagetest.ReadModel {
+		return memory.NewDB()
+	})
+}
+
+func TestDeadLetters(t *testing.T) {
+	storagetest.TestDeadLetters(t, func(*testing.T) query.DeadLetters {
+		return memory.NewDeadLetters()
+	})
+}
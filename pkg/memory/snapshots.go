@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+)
+
+// Snapshots is an in-memory cmd.SnapshotStore.
+type Snapshots struct {
+	mu        sync.RWMutex
+	snapshots map[string]cmd.Snapshot
+}
+
+func NewSnapshots() *Snapshots {
+	return &Snapshots{
+		snapshots: make(map[string]cmd.Snapshot),
+	}
+}
+
+func (s *Snapshots) Save(_ context.Context, snapshot cmd.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.snapshots[snapshot.AggregateId]; ok && stored.Version > snapshot.Version {
+		return nil
+	}
+
+	snapshot.Data = append([]byte(nil), snapshot.Data...)
+	s.snapshots[snapshot.AggregateId] = snapshot
+	return nil
+}
+
+func (s *Snapshots) Latest(_ context.Context, aggregateId string) (cmd.Snapshot, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot, ok := s.snapshots[aggregateId]
+	if !ok {
+		return cmd.Snapshot{}, false, nil
+	}
+
+	snapshot.Data = append([]byte(nil), snapshot.Data...)
+	return snapshot, true, nil
+}
@@ -0,0 +1,340 @@
+// Package migrate applies numbered SQL migrations to a database.
+//
+// Migrations are read from pairs of files named
+// NNNN_name.up.sql and NNNN_name.down.sql, usually embedded
+// in the binary. Applied migrations are recorded in a table
+// of the migrated database.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+)
+
+// DefaultTable is the table applied migrations are recorded in.
+const DefaultTable = "schema_migrations"
+
+// Migration changes the schema from Version-1 to Version and back.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status tells whether a migration has been applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Dialect holds what differs between database engines.
+type Dialect struct {
+	// Setup is executed first in every migration transaction unless empty.
+	// It usually lifts limits meant for regular statements, which
+	// a migration or the wait for the lock could exceed.
+	Setup string
+	// Lock is executed next in every migration transaction with the name
+	// of the migrations table as its only argument. It must block until
+	// no other transaction holds the lock of that table. It is left empty
+	// when beginning a transaction already locks the whole database.
+	Lock string
+	// Placeholder returns the n-th parameter of a statement, starting at 1.
+	Placeholder func(n int) string
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads the migrations in the root of fsys ordered by version.
+// Files which do not look like migrations are ignored.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid version of migration %q", entry.Name())
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations %q and %q have the same version", m.Name, match[2])
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrator applies and reverts migrations. Every call runs in a single
+// transaction holding the lock of the migrations table, so replicas
+// started at the same time apply each migration once and a failed
+// migration leaves the schema as it was.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	dialect    Dialect
+	table      string
+	clock      clock.Clock
+}
+
+type Option func(*Migrator)
+
+// WithTable sets the table applied migrations are recorded in.
+// Databases holding more than one set of migrations
+// need a table for every set.
+func WithTable(table string) Option {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// WithClock sets the clock which timestamps applied migrations.
+func WithClock(clock clock.Clock) Option {
+	return func(m *Migrator) {
+		m.clock = clock
+	}
+}
+
+// New loads the migrations in fsys. It does not touch the database.
+func New(db *sql.DB, fsys fs.FS, dialect Dialect, opts ...Option) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Migrator{
+		db:         db,
+		migrations: migrations,
+		dialect:    dialect,
+		table:      DefaultTable,
+		clock:      clock.System{},
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m, nil
+}
+
+// applied maps versions of applied migrations to their status.
+type applied map[int64]Status
+
+// Up applies all pending migrations in order and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+
+	err := m.run(ctx, func(tx *sql.Tx, applied applied) error {
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			insert := fmt.Sprintf(`INSERT INTO %s (version, name, applied_at) VALUES (%s, %s, %s)`,
+				m.table, m.dialect.Placeholder(1), m.dialect.Placeholder(2), m.dialect.Placeholder(3))
+			if _, err := tx.ExecContext(ctx, insert, migration.Version, migration.Name, m.clock.Now().UnixNano()); err != nil {
+				return err
+			}
+
+			done = append(done, migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return done, nil
+}
+
+// Down reverts at most steps of the most recently applied migrations,
+// newest first, and returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+
+	err := m.run(ctx, func(tx *sql.Tx, applied applied) error {
+		versions := make([]int64, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+
+		for _, version := range versions {
+			migration, ok := m.find(version)
+			if !ok {
+				return fmt.Errorf("migration %d_%s is applied but unknown, it cannot be reverted", version, applied[version].Name)
+			}
+
+			if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+				return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			remove := fmt.Sprintf(`DELETE FROM %s WHERE version = %s`, m.table, m.dialect.Placeholder(1))
+			if _, err := tx.ExecContext(ctx, remove, version); err != nil {
+				return err
+			}
+
+			done = append(done, migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return done, nil
+}
+
+// Status lists all known migrations and applied ones
+// which are not known anymore, ordered by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.run(ctx, func(_ *sql.Tx, applied applied) error {
+		for _, migration := range m.migrations {
+			status, ok := applied[migration.Version]
+			statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: status.AppliedAt})
+			delete(applied, migration.Version)
+		}
+		for _, status := range applied {
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// run takes the lock, creates the migrations table if needed and
+// calls fn with the applied migrations. Everything fn executes
+// is rolled back if it fails.
+func (m *Migrator) run(ctx context.Context, fn func(*sql.Tx, applied) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if m.dialect.Setup != "" {
+		if _, err := tx.ExecContext(ctx, m.dialect.Setup); err != nil {
+			return err
+		}
+	}
+
+	if m.dialect.Lock != "" {
+		if _, err := tx.ExecContext(ctx, m.dialect.Lock, m.table); err != nil {
+			return fmt.Errorf("failed to lock migrations: %w", err)
+		}
+	}
+
+	create := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT   NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`, m.table)
+	if _, err := tx.ExecContext(ctx, create); err != nil {
+		return err
+	}
+
+	applied, err := m.applied(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx, applied); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) applied(ctx context.Context, tx *sql.Tx) (applied, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT version, name, applied_at FROM %s`, m.table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(applied)
+	for rows.Next() {
+		var status Status
+		var appliedAt int64
+		if err := rows.Scan(&status.Version, &status.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		status.Applied = true
+		status.AppliedAt = time.Unix(0, appliedAt).UTC()
+		applied[status.Version] = status
+	}
+
+	return applied, rows.Err()
+}
@@ -0,0 +1,48 @@
+package migrate_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/krixlion/dev-forum_article/pkg/migrate"
+)
+
+func file(data string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(data)}
+}
+
+func TestLoadOrdersMigrations(t *testing.T) {
+	migrations, err := migrate.Load(fstest.MapFS{
+		"0010_tags.up.sql":   file("up 10"),
+		"0010_tags.down.sql": file("down 10"),
+		"0002_init.up.sql":   file("up 2"),
+		"0002_init.down.sql": file("down 2"),
+		"README.md":          file("docs"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to load migrations, err: %v", err)
+	}
+
+	if len(migrations) != 2 || migrations[0].Version != 2 || migrations[1].Version != 10 {
+		t.Fatalf("Unexpected migrations: %+v", migrations)
+	}
+	if migrations[0].Name != "init" || migrations[0].Up != "up 2" || migrations[0].Down != "down 2" {
+		t.Fatalf("Unexpected migration: %+v", migrations[0])
+	}
+}
+
+func TestLoadRejectsIncompleteMigrations(t *testing.T) {
+	if _, err := migrate.Load(fstest.MapFS{"0001_init.up.sql": file("up")}); err == nil {
+		t.Fatalf("Migration without a down file was loaded")
+	}
+
+	_, err := migrate.Load(fstest.MapFS{
+		"0001_init.up.sql":    file("up"),
+		"0001_init.down.sql":  file("down"),
+		"0001_other.up.sql":   file("up"),
+		"0001_other.down.sql": file("down"),
+	})
+	if err == nil {
+		t.Fatalf("Migrations with the same version were loaded")
+	}
+}
@@ -0,0 +1,313 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+)
+
+// fakeDialect is understood by fakeDB.
+var fakeDialect = Dialect{
+	Lock:        "LOCK",
+	Placeholder: func(int) string { return "?" },
+}
+
+// fakeDB is a database which only knows the statements of the Migrator.
+// Other statements are migrations, which are logged when they commit.
+// LOCK blocks until no other transaction holds it.
+type fakeDB struct {
+	lock sync.Mutex
+
+	mu      sync.Mutex
+	applied map[int64][]driver.Value
+	log     []string
+	// unlocked holds migrations executed without the lock.
+	unlocked []string
+}
+
+func newFakeDB(t *testing.T) (*fakeDB, *sql.DB) {
+	fake := &fakeDB{applied: make(map[int64][]driver.Value)}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+	return fake, db
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct {
+	db *fakeDB
+	tx *fakeTx
+}
+
+type fakeTx struct {
+	conn    *fakeConn
+	locked  bool
+	applied map[int64][]driver.Value
+	log     []string
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	applied := make(map[int64][]driver.Value, len(c.db.applied))
+	for version, row := range c.db.applied {
+		applied[version] = row
+	}
+	c.tx = &fakeTx{conn: c, applied: applied}
+	return c.tx, nil
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	tx := c.tx
+	if tx == nil {
+		return nil, errors.New("not in a transaction")
+	}
+
+	switch {
+	case query == "LOCK":
+		c.db.lock.Lock()
+		tx.locked = true
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS"):
+	case strings.HasPrefix(query, "INSERT INTO"):
+		tx.applied[args[0].Value.(int64)] = []driver.Value{args[0].Value, args[1].Value, args[2].Value}
+	case strings.HasPrefix(query, "DELETE FROM"):
+		delete(tx.applied, args[0].Value.(int64))
+	default:
+		if !tx.locked {
+			c.db.mu.Lock()
+			c.db.unlocked = append(c.db.unlocked, query)
+			c.db.mu.Unlock()
+		}
+		tx.log = append(tx.log, query)
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if c.tx == nil || !strings.HasPrefix(query, "SELECT version, name, applied_at") {
+		return nil, errors.New("not supported")
+	}
+
+	rows := &fakeRows{}
+	for _, row := range c.tx.applied {
+		rows.rows = append(rows.rows, row)
+	}
+	return rows, nil
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.conn.db.mu.Lock()
+	tx.conn.db.applied = tx.applied
+	tx.conn.db.log = append(tx.conn.db.log, tx.log...)
+	tx.conn.db.mu.Unlock()
+	return tx.Rollback()
+}
+
+func (tx *fakeTx) Rollback() error {
+	if tx.locked {
+		tx.locked = false
+		tx.conn.db.lock.Unlock()
+	}
+	tx.conn.tx = nil
+	return nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return []string{"version", "name", "applied_at"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var testMigrations = fstest.MapFS{
+	"0002_second.up.sql":   {Data: []byte("up 2")},
+	"0002_second.down.sql": {Data: []byte("down 2")},
+	"0001_first.up.sql":    {Data: []byte("up 1")},
+	"0001_first.down.sql":  {Data: []byte("down 1")},
+	"0003_third.up.sql":    {Data: []byte("up 3")},
+	"0003_third.down.sql":  {Data: []byte("down 3")},
+}
+
+func newTestMigrator(t *testing.T, db *sql.DB, opts ...Option) *Migrator {
+	t.Helper()
+
+	m, err := New(db, testMigrations, fakeDialect, opts...)
+	if err != nil {
+		t.Fatalf("Failed to load migrations, err: %v", err)
+	}
+	return m
+}
+
+func versions(migrations []Migration) []int64 {
+	var versions []int64
+	for _, m := range migrations {
+		versions = append(versions, m.Version)
+	}
+	return versions
+}
+
+func TestUpAppliesPendingMigrationsInOrder(t *testing.T) {
+	ctx := context.Background()
+	fake, db := newFakeDB(t)
+	m := newTestMigrator(t, db)
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Failed to migrate, err: %v", err)
+	}
+	if got := versions(applied); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Fatalf("Unexpected migrations applied: %v", got)
+	}
+
+	applied, err = m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Failed to migrate, err: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("Applied migrations were applied again: %v", versions(applied))
+	}
+
+	if want := []string{"up 1", "up 2", "up 3"}; !reflect.DeepEqual(fake.log, want) {
+		t.Fatalf("Unexpected statements: %v, want: %v", fake.log, want)
+	}
+	if len(fake.unlocked) != 0 {
+		t.Fatalf("Migrations ran without the lock: %v", fake.unlocked)
+	}
+}
+
+func TestDownRevertsNewestFirst(t *testing.T) {
+	ctx := context.Background()
+	fake, db := newFakeDB(t)
+	m := newTestMigrator(t, db)
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Failed to migrate, err: %v", err)
+	}
+
+	reverted, err := m.Down(ctx, 2)
+	if err != nil {
+		t.Fatalf("Failed to revert, err: %v", err)
+	}
+	if got := versions(reverted); !reflect.DeepEqual(got, []int64{3, 2}) {
+		t.Fatalf("Unexpected migrations reverted: %v", got)
+	}
+
+	// More steps than applied migrations revert all of them.
+	reverted, err = m.Down(ctx, 5)
+	if err != nil {
+		t.Fatalf("Failed to revert, err: %v", err)
+	}
+	if got := versions(reverted); !reflect.DeepEqual(got, []int64{1}) {
+		t.Fatalf("Unexpected migrations reverted: %v", got)
+	}
+
+	want := []string{"up 1", "up 2", "up 3", "down 3", "down 2", "down 1"}
+	if !reflect.DeepEqual(fake.log, want) {
+		t.Fatalf("Unexpected statements: %v, want: %v", fake.log, want)
+	}
+	if len(fake.unlocked) != 0 {
+		t.Fatalf("Migrations ran without the lock: %v", fake.unlocked)
+	}
+}
+
+func TestStatusListsAppliedAndUnknownMigrations(t *testing.T) {
+	ctx := context.Background()
+	_, db := newFakeDB(t)
+
+	appliedAt := time.Unix(1700000000, 0).UTC()
+	m := newTestMigrator(t, db, WithClock(clock.NewStepping(appliedAt, 0)))
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Failed to migrate, err: %v", err)
+	}
+
+	// A binary which only knows the first migration.
+	older, err := New(db, fstest.MapFS{
+		"0001_first.up.sql":   testMigrations["0001_first.up.sql"],
+		"0001_first.down.sql": testMigrations["0001_first.down.sql"],
+	}, fakeDialect)
+	if err != nil {
+		t.Fatalf("Failed to load migrations, err: %v", err)
+	}
+	if _, err := older.Down(ctx, 1); err == nil {
+		t.Fatal("Unknown migration was reverted")
+	}
+
+	if _, err := m.Down(ctx, 1); err != nil {
+		t.Fatalf("Failed to revert, err: %v", err)
+	}
+
+	statuses, err := older.Status(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read status, err: %v", err)
+	}
+
+	want := []Status{
+		{Migration: Migration{Version: 1, Name: "first", Up: "up 1", Down: "down 1"}, Applied: true, AppliedAt: appliedAt},
+		{Migration: Migration{Version: 2, Name: "second"}, Applied: true, AppliedAt: appliedAt},
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("Unexpected status:\n got: %+v\nwant: %+v", statuses, want)
+	}
+}
+
+func TestLockIsHeldUntilCommit(t *testing.T) {
+	ctx := context.Background()
+	fake, db := newFakeDB(t)
+
+	var wg sync.WaitGroup
+	applied := make([][]Migration, 4)
+	for i := range applied {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			done, err := newTestMigrator(t, db).Up(ctx)
+			if err != nil {
+				t.Errorf("Failed to migrate, err: %v", err)
+			}
+			applied[i] = done
+		}(i)
+	}
+	wg.Wait()
+
+	var all []Migration
+	for _, done := range applied {
+		all = append(all, done...)
+	}
+	got := versions(all)
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	if !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Fatalf("Migrations were not applied exactly once: %v", got)
+	}
+
+	if want := []string{"up 1", "up 2", "up 3"}; !reflect.DeepEqual(fake.log, want) {
+		t.Fatalf("Unexpected statements: %v, want: %v", fake.log, want)
+	}
+}
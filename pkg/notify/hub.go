@@ -0,0 +1,102 @@
+// Package notify implements an in-process hub
+// broadcasting article changes to their watchers.
+package notify
+
+import (
+	"sync"
+
+	"github.com/krixlion/dev-forum_article/pkg/grpc/pb"
+)
+
+type ChangeType uint8
+
+const (
+	Created ChangeType = iota + 1
+	Updated
+	Deleted
+	Restored
+)
+
+type Change struct {
+	Type    ChangeType
+	Article *pb.Article
+}
+
+type subscription struct {
+	mu      sync.Mutex
+	changes chan Change
+}
+
+// deliver never blocks. When the buffer is full the oldest pending
+// change is dropped so that the subscriber always sees the latest one.
+func (s *subscription) deliver(change Change) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		select {
+		case s.changes <- change:
+			return
+		default:
+		}
+
+		select {
+		case <-s.changes:
+		default:
+		}
+	}
+}
+
+// Hub is safe for concurrent use.
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[string]map[*subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subs: make(map[string]map[*subscription]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving changes of the article with the given id
+// and a function which releases the subscription. The channel is never closed.
+func (h *Hub) Subscribe(id string, buffer int) (<-chan Change, func()) {
+	if buffer < 1 {
+		buffer = 1
+	}
+
+	sub := &subscription{
+		changes: make(chan Change, buffer),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs[id] == nil {
+		h.subs[id] = make(map[*subscription]struct{})
+	}
+	h.subs[id][sub] = struct{}{}
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.subs[id], sub)
+		if len(h.subs[id]) == 0 {
+			delete(h.subs, id)
+		}
+	}
+
+	return sub.changes, unsubscribe
+}
+
+// Publish delivers the change to every subscriber of the changed article.
+func (h *Hub) Publish(change Change) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs[change.Article.GetId()] {
+		sub.deliver(change)
+	}
+}
@@ -0,0 +1,284 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+)
+
+// EventsChannel is notified by every transaction appending events
+// with the position of its last event as the payload.
+const EventsChannel = "events"
+
+// EventStore is a cmd.EventStore and a cmd.Outbox. The events table
+// doubles as the outbox, so events are queued for publishing
+// in the transaction which appends them.
+type EventStore struct {
+	db    *sql.DB
+	clock clock.Clock
+}
+
+// NewEventStore expects db to be migrated by NewWriteMigrator.
+// It takes ownership of db, which is closed by Close.
+func NewEventStore(db *sql.DB, clock clock.Clock) *EventStore {
+	return &EventStore{
+		db:    db,
+		clock: clock,
+	}
+}
+
+// Append lets appends to different aggregates run concurrently.
+// Appends to an aggregate are serialized by an advisory lock named
+// after it, which makes the version check and the inserts atomic.
+//
+// Positions are taken from a sequence, so a transaction may commit
+// a lower position after another one has committed a higher position.
+// A single lock around every append would prevent that, but it would
+// serialize all writes until their commit. Instead allocate_positions
+// locks every position it hands out until the transaction ends,
+// and readers stop before the first missing position which is still
+// locked. Positions of rolled back appends are skipped once unlocked.
+func (s *EventStore) Append(ctx context.Context, aggregateId string, expectedVersion int64, events []cmd.Event) ([]cmd.Event, error) {
+	return s.AppendAndScrub(ctx, aggregateId, expectedVersion, events, nil)
+}
+
+// AppendAndScrub updates the events in the transaction which appends.
+// Postgres keeps the old rows until the table is vacuumed.
+func (s *EventStore) AppendAndScrub(ctx context.Context, aggregateId string, expectedVersion int64, events []cmd.Event, data map[int64][]byte) ([]cmd.Event, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(2, hashtext($1))`, aggregateId); err != nil {
+		return nil, err
+	}
+
+	var version int64
+	row := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM events WHERE aggregate_id = $1`, aggregateId)
+	if err := row.Scan(&version); err != nil {
+		return nil, err
+	}
+
+	if version != expectedVersion {
+		return nil, cmd.ConcurrencyConflict(aggregateId, expectedVersion, version)
+	}
+
+	if len(events) == 0 && len(data) == 0 {
+		return nil, nil
+	}
+
+	if err := scrub(ctx, tx, aggregateId, data); err != nil {
+		return nil, err
+	}
+
+	positions, err := allocatePositions(ctx, tx, len(events))
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	appended := make([]cmd.Event, 0, len(events))
+	for i, event := range events {
+		event.AggregateId = aggregateId
+		event.Version = expectedVersion + int64(i) + 1
+		event.Position = positions[i]
+		event.RecordedAt = now
+
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO events (position, id, aggregate_id, version, type, data, recorded_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			event.Position, event.Id, event.AggregateId, event.Version, event.Type, event.Data, event.RecordedAt.UnixNano(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		appended = append(appended, event)
+	}
+
+	// Listeners are notified once the transaction commits.
+	if len(appended) > 0 {
+		head := strconv.FormatInt(appended[len(appended)-1].Position, 10)
+		if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, EventsChannel, head); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return appended, nil
+}
+
+func allocatePositions(ctx context.Context, tx *sql.Tx, n int) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT allocate_positions($1)`, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	positions := make([]int64, 0, n)
+	for rows.Next() {
+		var position int64
+		if err := rows.Scan(&position); err != nil {
+			return nil, err
+		}
+		positions = append(positions, position)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(positions) != n {
+		return nil, fmt.Errorf("allocated %d positions instead of %d", len(positions), n)
+	}
+	return positions, nil
+}
+
+// scrub replaces the data of the events at the versions given as keys.
+func scrub(ctx context.Context, tx *sql.Tx, aggregateId string, data map[int64][]byte) error {
+	for version, d := range data {
+		res, err := tx.ExecContext(ctx, `UPDATE events SET data = $1 WHERE aggregate_id = $2 AND version = $3`, d, aggregateId, version)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n != 1 {
+			return fmt.Errorf("event %d of %q does not exist", version, aggregateId)
+		}
+	}
+
+	return nil
+}
+
+const eventColumns = `id, aggregate_id, version, position, type, data, recorded_at`
+
+func (s *EventStore) Load(ctx context.Context, aggregateId string, fromVersion int64) ([]cmd.Event, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+eventColumns+` FROM events WHERE aggregate_id = $1 AND version >= $2 ORDER BY version`,
+		aggregateId, fromVersion,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+func (s *EventStore) ReadAll(ctx context.Context, afterPosition int64, limit int) ([]cmd.Event, error) {
+	return s.readAfter(ctx, afterPosition, limit)
+}
+
+// readAfter reads events after a position in the order of their positions.
+// It stops before the first missing position which is still being
+// appended, so that no event is committed behind the returned ones.
+func (s *EventStore) readAfter(ctx context.Context, afterPosition int64, limit int) ([]cmd.Event, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+eventColumns+` FROM events WHERE position > $1 ORDER BY position LIMIT $2`,
+		afterPosition, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	next := afterPosition + 1
+	for i, event := range events {
+		for ; next < event.Position; next++ {
+			var inFlight bool
+			if err := s.db.QueryRowContext(ctx, `SELECT position_in_flight($1)`, next).Scan(&inFlight); err != nil {
+				return nil, err
+			}
+			if inFlight {
+				return events[:i], nil
+			}
+
+			// The append may have committed after the events were read.
+			missed, err := s.at(ctx, next)
+			if err != nil {
+				return nil, err
+			}
+			if missed != nil {
+				return append(events[:i:i], *missed), nil
+			}
+		}
+		next = event.Position + 1
+	}
+
+	return events, nil
+}
+
+// at returns the event at a position or nil if there is none.
+func (s *EventStore) at(ctx context.Context, position int64) (*cmd.Event, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+eventColumns+` FROM events WHERE position = $1`, position)
+	if err != nil {
+		return nil, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	return &events[0], nil
+}
+
+func scanEvents(rows *sql.Rows) ([]cmd.Event, error) {
+	defer rows.Close()
+
+	var events []cmd.Event
+	for rows.Next() {
+		var event cmd.Event
+		var recordedAt int64
+		if err := rows.Scan(&event.Id, &event.AggregateId, &event.Version, &event.Position, &event.Type, &event.Data, &recordedAt); err != nil {
+			return nil, err
+		}
+		event.RecordedAt = time.Unix(0, recordedAt).UTC()
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// Head stops before the first position which is still being appended,
+// like readAfter, so that no event is committed behind it.
+func (s *EventStore) Head(ctx context.Context) (int64, error) {
+	var head int64
+	err := s.db.QueryRowContext(ctx, `SELECT committed_head()`).Scan(&head)
+	return head, err
+}
+
+func (s *EventStore) Unsent(ctx context.Context, limit int) ([]cmd.Event, error) {
+	var sent int64
+	if err := s.db.QueryRowContext(ctx, `SELECT sent FROM outbox WHERE id = 1`).Scan(&sent); err != nil {
+		return nil, err
+	}
+	return s.readAfter(ctx, sent, limit)
+}
+
+func (s *EventStore) MarkSent(ctx context.Context, position int64) error {
+	head, err := s.Head(ctx)
+	if err != nil {
+		return err
+	}
+	if position > head {
+		return fmt.Errorf("cannot mark position %d as sent, head is at %d", position, head)
+	}
+
+	_, err = s.db.ExecContext(ctx, `UPDATE outbox SET sent = GREATEST(sent, $1) WHERE id = 1`, position)
+	return err
+}
+
+func (s *EventStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/log"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultReconnectBackoff is how long Listen waits
+// before reconnecting after the connection was lost.
+const DefaultReconnectBackoff = time.Second
+
+// Listen calls wake whenever any replica appends events to the database
+// at cfg, until ctx is cancelled. It holds a connection of its own, so
+// that no connection is taken from the pools. Notifications sent while
+// it reconnects are lost, so wake is also called after every reconnect.
+func Listen(ctx context.Context, cfg Config, wake func()) error {
+	for {
+		err := listen(ctx, cfg, wake)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		log.PrintLn("msg", "lost connection listening for events", "err", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(DefaultReconnectBackoff):
+		}
+	}
+}
+
+func listen(ctx context.Context, cfg Config, wake func()) error {
+	connConfig, err := cfg.connConfig()
+	if err != nil {
+		return err
+	}
+
+	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, `LISTEN `+pgx.Identifier{EventsChannel}.Sanitize()); err != nil {
+		return err
+	}
+	wake()
+
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		wake()
+	}
+}
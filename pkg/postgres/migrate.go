@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+	"strconv"
+
+	"github.com/krixlion/dev-forum_article/pkg/migrate"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// Tables the migrations of both databases are recorded in,
+// which may be the same database.
+const (
+	WriteMigrationsTable = "event_store_migrations"
+	ReadMigrationsTable  = "read_model_migrations"
+)
+
+// Dialect serializes migrations with an advisory lock named after
+// the migrations table. Migrations are exempt from the statement timeout.
+var Dialect = migrate.Dialect{
+	Setup:       `SET LOCAL statement_timeout = 0`,
+	Lock:        `SELECT pg_advisory_xact_lock(1, hashtext($1))`,
+	Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+}
+
+// NewWriteMigrator migrates the database of the EventStore and Snapshots.
+func NewWriteMigrator(db *sql.DB, opts ...migrate.Option) (*migrate.Migrator, error) {
+	return newMigrator(db, "migrations/write", WriteMigrationsTable, opts)
+}
+
+// NewReadMigrator migrates the database of the ReadModel.
+func NewReadMigrator(db *sql.DB, opts ...migrate.Option) (*migrate.Migrator, error) {
+	return newMigrator(db, "migrations/read", ReadMigrationsTable, opts)
+}
+
+func newMigrator(db *sql.DB, dir, table string, opts []migrate.Option) (*migrate.Migrator, error) {
+	fsys, err := fs.Sub(migrations, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(db, fsys, Dialect, append([]migrate.Option{migrate.WithTable(table)}, opts...)...)
+}
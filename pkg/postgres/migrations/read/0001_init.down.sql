@@ -0,0 +1,3 @@
+DROP TABLE checkpoints;
+DROP TABLE articles_shadow;
+DROP TABLE articles;
@@ -0,0 +1,29 @@
+-- Tags are kept as a JSON array, times as Unix nanoseconds,
+-- which timestamptz cannot hold.
+CREATE TABLE articles (
+	id           TEXT PRIMARY KEY,
+	user_id      TEXT    NOT NULL,
+	title        TEXT    NOT NULL,
+	body         TEXT    NOT NULL,
+	tags         JSONB   NOT NULL,
+	version      BIGINT  NOT NULL,
+	created_at   BIGINT,
+	updated_at   BIGINT,
+	published_at BIGINT,
+	deleted_at   BIGINT,
+	purged       BOOLEAN NOT NULL
+);
+
+CREATE INDEX articles_created_at ON articles (created_at, id);
+CREATE INDEX articles_updated_at ON articles (updated_at, id);
+CREATE INDEX articles_user_id ON articles (user_id);
+CREATE INDEX articles_tags ON articles USING GIN (tags);
+
+-- Projections are rebuilt into the shadow table, which
+-- must be changed by every migration changing articles.
+CREATE TABLE articles_shadow (LIKE articles INCLUDING ALL);
+
+CREATE TABLE checkpoints (
+	model    TEXT PRIMARY KEY,
+	position BIGINT NOT NULL
+);
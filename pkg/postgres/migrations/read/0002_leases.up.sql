@@ -0,0 +1,11 @@
+-- A lease is held by one replica at a time until it expires,
+-- in Unix nanoseconds, unless the replica keeps renewing it.
+CREATE TABLE leases (
+	name       TEXT PRIMARY KEY,
+	owner      TEXT   NOT NULL,
+	expires_at BIGINT NOT NULL
+);
+
+-- Swapping in a rebuilt copy of a model moves it to the next generation,
+-- which fences off replicas still projecting into the previous one.
+ALTER TABLE checkpoints ADD COLUMN generation BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,19 @@
+-- Events the projection gave up on, which are behind the checkpoint
+-- until they are replayed. Times are kept as Unix nanoseconds.
+-- The letters of every copy of a model are kept apart by its table.
+CREATE TABLE dead_letters (
+	model        TEXT    NOT NULL,
+	position     BIGINT  NOT NULL,
+	id           TEXT    NOT NULL,
+	aggregate_id TEXT    NOT NULL,
+	version      BIGINT  NOT NULL,
+	type         TEXT    NOT NULL,
+	data         BYTEA,
+	recorded_at  BIGINT  NOT NULL,
+	err          TEXT    NOT NULL,
+	attempts     INTEGER NOT NULL,
+	failed_at    BIGINT  NOT NULL,
+	PRIMARY KEY (model, position)
+);
+
+CREATE INDEX dead_letters_aggregate_id ON dead_letters (model, aggregate_id, position);
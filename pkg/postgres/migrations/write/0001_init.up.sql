@@ -0,0 +1,25 @@
+-- Times are kept as Unix nanoseconds, which timestamptz cannot hold.
+CREATE TABLE events (
+	position     BIGSERIAL PRIMARY KEY,
+	id           TEXT   NOT NULL,
+	aggregate_id TEXT   NOT NULL,
+	version      BIGINT NOT NULL,
+	type         TEXT   NOT NULL,
+	data         BYTEA,
+	recorded_at  BIGINT NOT NULL,
+	UNIQUE (aggregate_id, version)
+);
+
+CREATE TABLE outbox (
+	id   INTEGER PRIMARY KEY CHECK (id = 1),
+	sent BIGINT NOT NULL
+);
+
+INSERT INTO outbox (id, sent) VALUES (1, 0);
+
+CREATE TABLE snapshots (
+	aggregate_id   TEXT PRIMARY KEY,
+	version        BIGINT  NOT NULL,
+	schema_version INTEGER NOT NULL,
+	data           BYTEA   NOT NULL
+);
@@ -0,0 +1,3 @@
+DROP FUNCTION committed_head();
+DROP FUNCTION position_in_flight(BIGINT);
+DROP FUNCTION allocate_positions(INTEGER);
@@ -0,0 +1,84 @@
+-- Appends take positions from the sequence of the events table
+-- while holding the allocation lock, the advisory lock of the key
+-- pair (0, 0), and lock each position, the advisory lock of its
+-- single bigint key, until their transaction ends. Single keys never
+-- overlap pairs. The allocation lock is held by the session only while
+-- the sequence is read, so that no position is ever handed out
+-- without being locked.
+CREATE FUNCTION allocate_positions(n INTEGER) RETURNS SETOF BIGINT
+LANGUAGE plpgsql AS $$
+DECLARE
+	p BIGINT;
+BEGIN
+	PERFORM pg_advisory_lock(0, 0);
+	BEGIN
+		FOR i IN 1..n LOOP
+			p := nextval('events_position_seq');
+			PERFORM pg_advisory_xact_lock(p);
+			RETURN NEXT p;
+		END LOOP;
+	EXCEPTION WHEN OTHERS OR query_canceled THEN
+		PERFORM pg_advisory_unlock(0, 0);
+		RAISE;
+	END;
+	PERFORM pg_advisory_unlock(0, 0);
+END
+$$;
+
+-- position_in_flight tells whether a position has been handed out
+-- to a transaction which has not ended yet. Once it returns false
+-- the event at the position is either visible or never will be.
+CREATE FUNCTION position_in_flight(p BIGINT) RETURNS BOOLEAN
+LANGUAGE plpgsql AS $$
+DECLARE
+	free BOOLEAN;
+BEGIN
+	PERFORM pg_advisory_lock(0, 0);
+	BEGIN
+		free := pg_try_advisory_lock(p);
+		IF free THEN
+			PERFORM pg_advisory_unlock(p);
+		END IF;
+	EXCEPTION WHEN OTHERS OR query_canceled THEN
+		PERFORM pg_advisory_unlock(0, 0);
+		RAISE;
+	END;
+	PERFORM pg_advisory_unlock(0, 0);
+	RETURN NOT free;
+END
+$$;
+
+-- committed_head returns the greatest position up to which every event
+-- is either visible or never will be, the rule readers stop by. Under
+-- the allocation lock, positions handed out so far are at most the last
+-- value of the sequence, and those still in flight hold their locks.
+CREATE FUNCTION committed_head() RETURNS BIGINT
+LANGUAGE plpgsql AS $$
+DECLARE
+	allocated BIGINT;
+	in_flight BIGINT;
+	head BIGINT;
+BEGIN
+	PERFORM pg_advisory_lock(0, 0);
+	BEGIN
+		SELECT CASE WHEN is_called THEN last_value ELSE 0 END INTO allocated
+		FROM events_position_seq;
+
+		-- Single bigint keys are split into classid and objid.
+		SELECT MIN((classid::BIGINT << 32) | objid::BIGINT) INTO in_flight
+		FROM pg_locks
+		WHERE locktype = 'advisory' AND objsubid = 1 AND granted
+			AND database = (SELECT oid FROM pg_database WHERE datname = current_database());
+	EXCEPTION WHEN OTHERS OR query_canceled THEN
+		PERFORM pg_advisory_unlock(0, 0);
+		RAISE;
+	END;
+	PERFORM pg_advisory_unlock(0, 0);
+
+	-- Appends which ended by now are visible to this statement.
+	SELECT COALESCE(MAX(position), 0) INTO head
+	FROM events
+	WHERE position <= allocated AND (in_flight IS NULL OR position < in_flight);
+	RETURN head;
+END
+$$;
@@ -0,0 +1,144 @@
+// Package postgres implements the event store on PostgreSQL databases,
+// along with the read model and the snapshots of package sqlstore.
+//
+// Events and articles may live in different databases, each reached
+// through its own pool, so that reads never wait for connections
+// taken by writes and the other way around.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Advisory locks taken by the package. Positions of events are locked
+// by their single bigint keys, everything else by pairs of keys, which
+// never overlap single keys. The first key of a pair tells what
+// the second one names:
+//
+//	(0, 0)                        allocation of positions
+//	(1, hashtext(table))          migrations and tables of the read model
+//	(2, hashtext(aggregate ID))   appends to an aggregate
+
+const (
+	DefaultMaxOpenConns     = 10
+	DefaultMaxIdleConns     = 10
+	DefaultConnMaxLifetime  = time.Hour
+	DefaultStatementTimeout = 30 * time.Second
+)
+
+// Config locates a database. Empty fields fall back
+// to the PG* environment variables and libpq defaults.
+type Config struct {
+	Host     string
+	Port     string
+	DBName   string
+	User     string
+	Password string
+}
+
+// connConfig builds the configuration of a single connection.
+func (c Config) connConfig() (*pgx.ConnConfig, error) {
+	config, err := pgx.ParseConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Host != "" {
+		config.Host = c.Host
+	}
+	if c.Port != "" {
+		port, err := strconv.ParseUint(c.Port, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q: %w", c.Port, err)
+		}
+		config.Port = uint16(port)
+	}
+	if c.DBName != "" {
+		config.Database = c.DBName
+	}
+	if c.User != "" {
+		config.User = c.User
+	}
+	if c.Password != "" {
+		config.Password = c.Password
+	}
+
+	return config, nil
+}
+
+type config struct {
+	maxOpenConns     int
+	maxIdleConns     int
+	connMaxLifetime  time.Duration
+	statementTimeout time.Duration
+}
+
+type Option func(*config)
+
+// WithMaxOpenConns limits the size of the connection pool.
+func WithMaxOpenConns(n int) Option {
+	return func(c *config) {
+		c.maxOpenConns = n
+	}
+}
+
+// WithMaxIdleConns sets how many connections are kept open when idle.
+func WithMaxIdleConns(n int) Option {
+	return func(c *config) {
+		c.maxIdleConns = n
+	}
+}
+
+// WithConnMaxLifetime sets after how long connections are reopened.
+func WithConnMaxLifetime(d time.Duration) Option {
+	return func(c *config) {
+		c.connMaxLifetime = d
+	}
+}
+
+// WithStatementTimeout sets after how long the server cancels
+// a statement, 0 for no limit. Migrations are not limited.
+func WithStatementTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.statementTimeout = d
+	}
+}
+
+// Open opens a pool of connections to the database.
+func Open(ctx context.Context, cfg Config, opts ...Option) (*sql.DB, error) {
+	c := config{
+		maxOpenConns:     DefaultMaxOpenConns,
+		maxIdleConns:     DefaultMaxIdleConns,
+		connMaxLifetime:  DefaultConnMaxLifetime,
+		statementTimeout: DefaultStatementTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	connConfig, err := cfg.connConfig()
+	if err != nil {
+		return nil, err
+	}
+	connConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(c.statementTimeout.Milliseconds(), 10)
+
+	db := stdlib.OpenDB(*connConfig)
+	db.SetMaxOpenConns(c.maxOpenConns)
+	db.SetMaxIdleConns(c.maxIdleConns)
+	db.SetConnMaxLifetime(c.connMaxLifetime)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,269 @@
+//go:build postgres
+
+// The tests need a Postgres-compatible server located by the PG* environment
+// variables, such as the one in docker-compose.yml started by make test-postgres.
+// Every test creates a database of its own, which is dropped afterwards.
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/migrate"
+	"github.com/krixlion/dev-forum_article/pkg/postgres"
+	"github.com/krixlion/dev-forum_article/pkg/query"
+	"github.com/krixlion/dev-forum_article/pkg/storagetest"
+)
+
+var databases atomic.Int64
+
+// createDatabase creates an empty database and returns its location.
+func createDatabase(t *testing.T) postgres.Config {
+	t.Helper()
+	ctx := context.Background()
+
+	admin, err := postgres.Open(ctx, postgres.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to the server, err: %v", err)
+	}
+
+	name := fmt.Sprintf("article_test_%d_%d", time.Now().UnixNano(), databases.Add(1))
+	if _, err := admin.ExecContext(ctx, `CREATE DATABASE `+name); err != nil {
+		admin.Close()
+		t.Fatalf("Failed to create database, err: %v", err)
+	}
+
+	t.Cleanup(func() {
+		defer admin.Close()
+		if _, err := admin.ExecContext(ctx, `DROP DATABASE `+name+` WITH (FORCE)`); err != nil {
+			t.Errorf("Failed to drop database, err: %v", err)
+		}
+	})
+
+	return postgres.Config{DBName: name}
+}
+
+type newMigrator func(*sql.DB, ...migrate.Option) (*migrate.Migrator, error)
+
+func openMigrated(t *testing.T, config postgres.Config, newMigrator newMigrator) *sql.DB {
+	t.Helper()
+
+	db, err := postgres.Open(context.Background(), config, postgres.WithMaxOpenConns(4))
+	if err != nil {
+		t.Fatalf("Failed to open database, err: %v", err)
+	}
+
+	migrator, err := newMigrator(db)
+	if err != nil {
+		t.Fatalf("Failed to load migrations, err: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate, err: %v", err)
+	}
+
+	return db
+}
+
+func TestEventStore(t *testing.T) {
+	storagetest.TestEventStore(t, func(t *testing.T) storagetest.EventStore {
+		return postgres.NewEventStore(openMigrated(t, createDatabase(t), postgres.NewWriteMigrator), clock.System{})
+	})
+}
+
+func TestSnapshots(t *testing.T) {
+	storagetest.TestSnapshotStore(t, func(t *testing.T) cmd.SnapshotStore {
+		db := openMigrated(t, createDatabase(t), postgres.NewWriteMigrator)
+		t.Cleanup(func() { db.Close() })
+		return postgres.NewSnapshots(db)
+	})
+}
+
+func TestReadModel(t *testing.T) {
+	storagetest.TestReadModel(t, func(t *testing.T) storagetest.ReadModel {
+		return postgres.NewReadModel(openMigrated(t, createDatabase(t), postgres.NewReadMigrator))
+	})
+}
+
+func TestDeadLetters(t *testing.T) {
+	storagetest.TestDeadLetters(t, func(t *testing.T) query.DeadLetters {
+		db := openMigrated(t, createDatabase(t), postgres.NewReadMigrator)
+		t.Cleanup(func() { db.Close() })
+		return postgres.NewDeadLetters(db)
+	})
+}
+
+func TestMigrationsRunOnceAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	config := createDatabase(t)
+
+	var wg sync.WaitGroup
+	applied := make([]int, 4)
+	for i := range applied {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			db, err := postgres.Open(ctx, config)
+			if err != nil {
+				t.Errorf("Failed to open database, err: %v", err)
+				return
+			}
+			defer db.Close()
+
+			for _, newMigrator := range []newMigrator{postgres.NewWriteMigrator, postgres.NewReadMigrator} {
+				migrator, err := newMigrator(db)
+				if err != nil {
+					t.Errorf("Failed to load migrations, err: %v", err)
+					return
+				}
+				done, err := migrator.Up(ctx)
+				if err != nil {
+					t.Errorf("Failed to migrate, err: %v", err)
+					return
+				}
+				applied[i] += len(done)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, n := range applied {
+		total += n
+	}
+	if total != 5 {
+		t.Fatalf("Migrations were not applied exactly once, applied: %v", applied)
+	}
+}
+
+func TestConcurrentAppendsKeepPositionsInOrder(t *testing.T) {
+	ctx := context.Background()
+
+	store := postgres.NewEventStore(openMigrated(t, createDatabase(t), postgres.NewWriteMigrator), clock.System{})
+	defer store.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := store.Append(ctx, fmt.Sprint(i), 0, []cmd.Event{{Type: "x"}, {Type: "y"}}); err != nil {
+				t.Errorf("Failed to append, err: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	events, err := store.ReadAll(ctx, 0, 100)
+	if err != nil {
+		t.Fatalf("Failed to read, err: %v", err)
+	}
+	if len(events) != 16 {
+		t.Fatalf("Unexpected number of events: %v", len(events))
+	}
+	// Events of a single append are next to each other.
+	for i := 0; i < len(events); i += 2 {
+		if events[i].AggregateId != events[i+1].AggregateId || events[i+1].Position != events[i].Position+1 {
+			t.Fatalf("Appends were interleaved: %+v, %+v", events[i], events[i+1])
+		}
+	}
+}
+
+func TestReadAllStopsBeforeAppendsInFlight(t *testing.T) {
+	ctx := context.Background()
+
+	db := openMigrated(t, createDatabase(t), postgres.NewWriteMigrator)
+	store := postgres.NewEventStore(db, clock.System{})
+	defer store.Close()
+
+	// An append which took the first position but has not committed yet.
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("Failed to begin, err: %v", err)
+	}
+	defer tx.Rollback()
+
+	var inFlight int64
+	if err := tx.QueryRowContext(ctx, `SELECT allocate_positions(1)`).Scan(&inFlight); err != nil {
+		t.Fatalf("Failed to allocate a position, err: %v", err)
+	}
+
+	appended, err := store.Append(ctx, "a", 0, []cmd.Event{{Type: "x"}})
+	if err != nil {
+		t.Fatalf("Failed to append, err: %v", err)
+	}
+	if appended[0].Position <= inFlight {
+		t.Fatalf("Position %d was handed out twice", inFlight)
+	}
+
+	events, err := store.ReadAll(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("Failed to read, err: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("Events behind an append in flight were read: %+v", events)
+	}
+	if head, err := store.Head(ctx); err != nil || head != 0 {
+		t.Fatalf("Head is past an append in flight, head: %v, err: %v", head, err)
+	}
+
+	// Once rolled back the position is skipped.
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back, err: %v", err)
+	}
+
+	events, err = store.ReadAll(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("Failed to read, err: %v", err)
+	}
+	if len(events) != 1 || events[0].Position != appended[0].Position {
+		t.Fatalf("Unexpected events: %+v", events)
+	}
+	if head, err := store.Head(ctx); err != nil || head != appended[0].Position {
+		t.Fatalf("Unexpected head: %v, err: %v", head, err)
+	}
+}
+
+func TestListenWakesOnAppend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := createDatabase(t)
+	store := postgres.NewEventStore(openMigrated(t, config, postgres.NewWriteMigrator), clock.System{})
+	defer store.Close()
+
+	wakes := make(chan struct{}, 8)
+	done := make(chan error, 1)
+	go func() {
+		done <- postgres.Listen(ctx, config, func() { wakes <- struct{}{} })
+	}()
+
+	// Listen wakes once it is listening, events appended before are not missed.
+	select {
+	case <-wakes:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Listener did not start")
+	}
+
+	if _, err := store.Append(ctx, "a", 0, []cmd.Event{{Type: "x"}}); err != nil {
+		t.Fatalf("Failed to append, err: %v", err)
+	}
+
+	select {
+	case <-wakes:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Listener was not woken by the append")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Listen did not stop, err: %v", err)
+	}
+}
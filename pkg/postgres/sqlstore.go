@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/krixlion/dev-forum_article/pkg/sqlstore"
+)
+
+// storeDialect serializes writes to a table of the read model
+// with an advisory lock named after the table.
+var storeDialect = sqlstore.Dialect{
+	Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	Lock:        `SELECT pg_advisory_xact_lock(1, hashtext($1))`,
+	Greatest:    "GREATEST",
+	HasTag: func(placeholder string) string {
+		return "tags @> jsonb_build_array(" + placeholder + "::text)"
+	},
+}
+
+// NewReadModel expects db to be migrated by NewReadMigrator.
+// It takes ownership of db, which is closed by Close.
+func NewReadModel(db *sql.DB, opts ...sqlstore.Option) *sqlstore.ReadModel {
+	return sqlstore.NewReadModel(db, storeDialect, opts...)
+}
+
+// NewDeadLetters expects db to be migrated by NewReadMigrator.
+// It does not take ownership of db.
+func NewDeadLetters(db *sql.DB) *sqlstore.DeadLetters {
+	return sqlstore.NewDeadLetters(db, storeDialect)
+}
+
+// NewSnapshots expects db to be migrated by NewWriteMigrator.
+// It does not take ownership of db.
+func NewSnapshots(db *sql.DB) *sqlstore.Snapshots {
+	return sqlstore.NewSnapshots(db, storeDialect)
+}
@@ -0,0 +1,49 @@
+package query
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+)
+
+// Waiter blocks reads until the read model reflects given writes.
+type Waiter interface {
+	// WaitFor returns once the event at position has been projected
+	// or fails with the error of ctx.
+	WaitFor(ctx context.Context, position int64) error
+}
+
+type consistencyToken struct {
+	Position int64 `json:"p"`
+}
+
+// EncodeConsistencyToken returns an opaque token pointing
+// at the position of the last event of a write.
+func EncodeConsistencyToken(position int64) string {
+	raw, _ := json.Marshal(consistencyToken{Position: position})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeConsistencyToken parses a token returned by EncodeConsistencyToken.
+// It returns 0 for an empty token.
+func DecodeConsistencyToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	invalid := entity.InvalidArgument(entity.FieldViolation{Field: "consistency_token", Description: "is malformed"})
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, invalid
+	}
+
+	var t consistencyToken
+	if err := json.Unmarshal(raw, &t); err != nil || t.Position < 0 {
+		return 0, invalid
+	}
+
+	return t.Position, nil
+}
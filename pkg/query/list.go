@@ -0,0 +1,122 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+type Order uint8
+
+const (
+	// OrderNewest sorts by creation time, most recent first.
+	OrderNewest Order = iota
+	// OrderOldest sorts by creation time, least recent first.
+	OrderOldest
+	// OrderRecentlyUpdated sorts by update time, most recent first.
+	OrderRecentlyUpdated
+)
+
+// Filter narrows down listed articles. Zero values match everything.
+type Filter struct {
+	UserId string
+	Tag    string
+	// CreatedAfter is inclusive.
+	CreatedAfter time.Time
+	// CreatedBefore is exclusive.
+	CreatedBefore time.Time
+}
+
+// Cursor points at the last article of the previous page.
+// SortKey is the creation or update time depending on the Order.
+type Cursor struct {
+	SortKey time.Time
+	Id      string
+}
+
+// After reports whether an article with the given sort key and id
+// comes after the cursor in the given order. Ties on the sort key
+// are broken by id in ascending order.
+func (c Cursor) After(order Order, sortKey time.Time, id string) bool {
+	if sortKey.Equal(c.SortKey) {
+		return id > c.Id
+	}
+	if order == OrderOldest {
+		return sortKey.After(c.SortKey)
+	}
+	return sortKey.Before(c.SortKey)
+}
+
+type ListParams struct {
+	Filter Filter
+	Order  Order
+	Limit  int
+	// After is nil for the first page.
+	After *Cursor
+}
+
+// Page is a single page of listed articles.
+// Next is nil when there are no more pages.
+type Page[T any] struct {
+	Items []T
+	Next  *Cursor
+}
+
+type pageToken struct {
+	Fingerprint uint64    `json:"f"`
+	SortKey     time.Time `json:"k"`
+	Id          string    `json:"i"`
+}
+
+// fingerprint binds page tokens to the filter and order they were issued for.
+func fingerprint(filter Filter, order Order) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d|%s|%s|%d|%d", order, filter.UserId, filter.Tag, filter.CreatedAfter.UnixNano(), filter.CreatedBefore.UnixNano())
+	return h.Sum64()
+}
+
+// EncodePageToken returns an opaque token pointing at the cursor.
+func EncodePageToken(filter Filter, order Order, cursor Cursor) string {
+	raw, _ := json.Marshal(pageToken{
+		Fingerprint: fingerprint(filter, order),
+		SortKey:     cursor.SortKey,
+		Id:          cursor.Id,
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodePageToken parses a token returned by EncodePageToken.
+// It returns a nil cursor for an empty token and fails if the token
+// was issued for a different filter or order.
+func DecodePageToken(token string, filter Filter, order Order) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	invalid := entity.InvalidArgument(entity.FieldViolation{Field: "page_token", Description: "is malformed or does not match the request"})
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, invalid
+	}
+
+	var t pageToken
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, invalid
+	}
+
+	if t.Fingerprint != fingerprint(filter, order) {
+		return nil, invalid
+	}
+
+	return &Cursor{SortKey: t.SortKey, Id: t.Id}, nil
+}
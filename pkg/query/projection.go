@@ -0,0 +1,115 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+)
+
+// ReadModel is a Storage kept up to date by a Runner.
+type ReadModel interface {
+	Storage
+	// Apply projects an event at the given version of its article and
+	// stores position as the checkpoint in the same step. Events at or
+	// below the projected version of the article must be ignored so
+	// that redelivered events are harmless. An event which does not
+	// directly follow the projected version must be rejected.
+	Apply(ctx context.Context, event entity.Event, version, position int64) error
+	// SaveCheckpoint stores the position of an event which was skipped.
+	SaveCheckpoint(ctx context.Context, position int64) error
+	// Checkpoint returns the position of the last applied or skipped event.
+	Checkpoint(ctx context.Context) (int64, error)
+}
+
+// VersionGap is returned by ReadModel.Apply when events
+// of an article are missing from the projection.
+func VersionGap(id string, projected, version int64) error {
+	return fmt.Errorf("cannot apply version %d of article %q projected at version %d", version, id, projected)
+}
+
+// DeadLetter is an event which could not be projected.
+type DeadLetter struct {
+	Event cmd.Event
+	Err   string
+	// Attempts is 0 for events which were not applied because
+	// an earlier event of the same aggregate was dead-lettered.
+	Attempts int
+	FailedAt time.Time
+}
+
+// DeadLetters keeps events the Runner gave up on, so that
+// they can be inspected and replayed once the cause is fixed.
+// It must outlive the process whenever the checkpoint does,
+// since dead-lettered events are behind the checkpoint.
+type DeadLetters interface {
+	// Add stores the letter, replacing the one of the same event.
+	Add(ctx context.Context, letter DeadLetter) error
+	// List returns letters ordered by the position of their events.
+	List(ctx context.Context) ([]DeadLetter, error)
+	// Halted reports whether an event of the aggregate before position
+	// is dead-lettered, in which case the event must not be projected.
+	Halted(ctx context.Context, aggregateId string, position int64) (bool, error)
+	// Remove deletes the letter of the event at position.
+	Remove(ctx context.Context, position int64) error
+}
+
+// ShadowDeadLetters are DeadLetters which keep the letters of a shadow
+// copy of a Rebuildable apart from the live ones. A rebuild neither
+// sees the letters of the live model nor changes them.
+type ShadowDeadLetters interface {
+	DeadLetters
+	// Shadow returns the empty letters of a copy returned by Rebuildable.Shadow.
+	Shadow(ctx context.Context, shadow ReadModel) (DeadLetters, error)
+	// Swap replaces the letters with the letters returned by Shadow.
+	// It is called once the copy is swapped in by Rebuildable.Swap.
+	Swap(ctx context.Context, shadow DeadLetters) error
+}
+
+// Rebuildable is a ReadModel which can be rebuilt from scratch
+// without disturbing its readers.
+type Rebuildable interface {
+	ReadModel
+	// Shadow returns an empty copy of the model invisible to readers.
+	Shadow(ctx context.Context) (ReadModel, error)
+	// Swap atomically replaces the contents of the model with
+	// the contents of a shadow returned by Shadow.
+	Swap(ctx context.Context, shadow ReadModel) error
+}
+
+// ErrSwapped is returned by a model or dead letters returned by
+// Fenced.Fence once a rebuilt copy of the model is swapped in.
+var ErrSwapped = errors.New("a rebuilt copy of the projection was swapped in")
+
+// Fenced is a Rebuildable shared by replicas of the service, one of
+// which may swap in a rebuilt copy while the others project events.
+// The Runner fences the model before every batch of events, so that
+// it does not apply events, move the checkpoint or dead-letter events
+// against a copy it did not read the state of.
+type Fenced interface {
+	// Fence returns the model and its dead letters, whose writes
+	// fail with ErrSwapped once a rebuilt copy is swapped in.
+	Fence(ctx context.Context, deadLetters DeadLetters) (ReadModel, DeadLetters, error)
+}
+
+// ErrRebuildLocked is returned by RebuildLocker.LockRebuild
+// when another replica is rebuilding the model.
+var ErrRebuildLocked = errors.New("the projection is being rebuilt by another replica")
+
+// RebuildLocker is a Rebuildable shared by replicas of the service,
+// only one of which may rebuild it at a time.
+type RebuildLocker interface {
+	// LockRebuild takes the lock of rebuilds until unlock is called.
+	// The returned context is cancelled if the lock is lost
+	// before that. Shadow and Swap fail without the lock.
+	LockRebuild(ctx context.Context) (locked context.Context, unlock func(), err error)
+}
+
+// EventSource is the log read by a Runner, usually a cmd.EventStore.
+type EventSource interface {
+	ReadAll(ctx context.Context, afterPosition int64, limit int) ([]cmd.Event, error)
+	Head(ctx context.Context) (int64, error)
+}
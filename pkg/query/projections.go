@@ -0,0 +1,115 @@
+package query
+
+import (
+	"context"
+	"fmt"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+)
+
+// Projections keeps the runners of the service by their names.
+type Projections struct {
+	runners []*Runner
+}
+
+func NewProjections(runners ...*Runner) *Projections {
+	return &Projections{
+		runners: runners,
+	}
+}
+
+// Rebuild rebuilds the named projections one after another,
+// or all of them if no names are given.
+func (p *Projections) Rebuild(ctx context.Context, names []string, progress func(Progress)) error {
+	runners, err := p.selected(names)
+	if err != nil {
+		return err
+	}
+
+	for _, runner := range runners {
+		if err := runner.Rebuild(ctx, progress); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ProjectionDeadLetter is a DeadLetter of the named projection.
+type ProjectionDeadLetter struct {
+	Projection string
+	DeadLetter
+}
+
+// DeadLetters lists dead letters of the named projections,
+// or of all of them if no names are given.
+func (p *Projections) DeadLetters(ctx context.Context, names []string) ([]ProjectionDeadLetter, error) {
+	runners, err := p.selected(names)
+	if err != nil {
+		return nil, err
+	}
+
+	var letters []ProjectionDeadLetter
+	for _, runner := range runners {
+		runnerLetters, err := runner.DeadLetters(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, letter := range runnerLetters {
+			letters = append(letters, ProjectionDeadLetter{Projection: runner.Name(), DeadLetter: letter})
+		}
+	}
+
+	return letters, nil
+}
+
+// ReplayDeadLetters replays dead letters of the named projections,
+// or of all of them if no names are given. If aggregateIds are given,
+// only their letters are replayed. It returns how many were replayed.
+func (p *Projections) ReplayDeadLetters(ctx context.Context, names []string, aggregateIds []string) (int, error) {
+	runners, err := p.selected(names)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, runner := range runners {
+		n, err := runner.ReplayDeadLetters(ctx, aggregateIds)
+		replayed += n
+		if err != nil {
+			return replayed, err
+		}
+	}
+
+	return replayed, nil
+}
+
+func (p *Projections) selected(names []string) ([]*Runner, error) {
+	if len(names) == 0 {
+		return p.runners, nil
+	}
+
+	byName := make(map[string]*Runner, len(p.runners))
+	for _, runner := range p.runners {
+		byName[runner.Name()] = runner
+	}
+
+	var selected []*Runner
+	var violations []entity.FieldViolation
+	for i, name := range names {
+		runner, ok := byName[name]
+		if !ok {
+			violations = append(violations, entity.FieldViolation{
+				Field:       fmt.Sprintf("projections[%d]", i),
+				Description: fmt.Sprintf("%q is not a known projection", name),
+			})
+			continue
+		}
+		selected = append(selected, runner)
+	}
+
+	if len(violations) > 0 {
+		return nil, entity.InvalidArgument(violations...)
+	}
+	return selected, nil
+}
@@ -0,0 +1,473 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/log"
+)
+
+const (
+	DefaultProjectionName = "articles"
+	DefaultBatchSize      = 100
+	DefaultPollInterval   = time.Second
+	DefaultMaxAttempts    = 5
+	DefaultRetryBackoff   = 100 * time.Millisecond
+)
+
+// Progress reports how far a projection has been rebuilt.
+type Progress struct {
+	Projection string
+	// Position of the last event applied to the shadow copy.
+	Position int64
+	// Head is the position of the last event in the source
+	// when the current batch was read.
+	Head int64
+	// Done is set once the copy has been swapped in.
+	Done bool
+}
+
+// Runner feeds events from an EventSource to a ReadModel, starting
+// after the checkpoint of the model. Events which keep failing are
+// moved to DeadLetters, so that one bad event does not block the rest.
+// The aggregate of such an event is not projected any further until
+// its dead letters are replayed.
+type Runner struct {
+	name         string
+	source       EventSource
+	codec        cmd.EventCodec
+	model        ReadModel
+	deadLetters  DeadLetters
+	batchSize    int
+	pollInterval time.Duration
+	maxAttempts  int
+	backoff      time.Duration
+	wake         chan struct{}
+	// mu is held while events are applied to the live model.
+	mu         sync.Mutex
+	rebuilding atomic.Bool
+	// advanced is closed and replaced whenever
+	// the checkpoint of the live model may have moved.
+	advancedMu sync.Mutex
+	advanced   chan struct{}
+}
+
+type RunnerOption func(*Runner)
+
+// WithName sets the name the projection is rebuilt by.
+func WithName(name string) RunnerOption {
+	return func(r *Runner) {
+		r.name = name
+	}
+}
+
+// WithBatchSize sets how many events are read from the source at once.
+func WithBatchSize(size int) RunnerOption {
+	return func(r *Runner) {
+		r.batchSize = size
+	}
+}
+
+// WithPollInterval sets how often the source is checked
+// for new events when the Runner is not woken up.
+func WithPollInterval(interval time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.pollInterval = interval
+	}
+}
+
+// WithRetry sets how many times an event is applied before it is
+// dead-lettered. The n-th retry is delayed by n times backoff.
+func WithRetry(maxAttempts int, backoff time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.maxAttempts = maxAttempts
+		r.backoff = backoff
+	}
+}
+
+func NewRunner(source EventSource, codec cmd.EventCodec, model ReadModel, deadLetters DeadLetters, opts ...RunnerOption) *Runner {
+	r := &Runner{
+		name:         DefaultProjectionName,
+		source:       source,
+		codec:        codec,
+		model:        model,
+		deadLetters:  deadLetters,
+		batchSize:    DefaultBatchSize,
+		pollInterval: DefaultPollInterval,
+		maxAttempts:  DefaultMaxAttempts,
+		backoff:      DefaultRetryBackoff,
+		wake:         make(chan struct{}, 1),
+		advanced:     make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+func (r *Runner) Name() string {
+	return r.name
+}
+
+// Wake makes the Runner check for new events without waiting
+// for the poll interval. It never blocks.
+func (r *Runner) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run projects events until ctx is cancelled.
+func (r *Runner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.catchUp(ctx); err != nil && ctx.Err() == nil {
+			log.PrintLn("msg", "failed to project events", "projection", r.name, "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Runner) catchUp(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.advance()
+
+	return r.feed(ctx, r.model, r.deadLetters, func(Progress) { r.advance() })
+}
+
+// advance wakes up everyone waiting in WaitFor.
+func (r *Runner) advance() {
+	r.advancedMu.Lock()
+	defer r.advancedMu.Unlock()
+
+	close(r.advanced)
+	r.advanced = make(chan struct{})
+}
+
+func (r *Runner) advancedChan() <-chan struct{} {
+	r.advancedMu.Lock()
+	defer r.advancedMu.Unlock()
+
+	return r.advanced
+}
+
+// WaitFor blocks until the live model has projected the event at position.
+func (r *Runner) WaitFor(ctx context.Context, position int64) error {
+	for {
+		// Take the channel before reading the checkpoint,
+		// so that an advance in between is not missed.
+		advanced := r.advancedChan()
+
+		checkpoint, err := r.model.Checkpoint(ctx)
+		if err != nil {
+			return err
+		}
+		if checkpoint >= position {
+			return nil
+		}
+
+		r.Wake()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-advanced:
+		}
+	}
+}
+
+// Rebuild replays all events into a shadow copy of the model and
+// swaps it in once it has caught up. The live model keeps being
+// updated and served until the swap. Events which fail are
+// dead-lettered for the copy, whose letters replace the live ones
+// on the swap. Progress is reported after every batch.
+func (r *Runner) Rebuild(ctx context.Context, progress func(Progress)) error {
+	model, ok := r.model.(Rebuildable)
+	if !ok {
+		return fmt.Errorf("projection %q cannot be rebuilt", r.name)
+	}
+	deadLetters, ok := r.deadLetters.(ShadowDeadLetters)
+	if !ok {
+		return fmt.Errorf("dead letters of projection %q cannot be rebuilt", r.name)
+	}
+
+	ctx, unlock, err := r.lockRebuild(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	shadow, err := model.Shadow(ctx)
+	if err != nil {
+		return err
+	}
+	shadowLetters, err := deadLetters.Shadow(ctx, shadow)
+	if err != nil {
+		return err
+	}
+
+	if err := r.feed(ctx, shadow, shadowLetters, progress); err != nil {
+		return err
+	}
+
+	// Stop the live projection so that no event is applied
+	// to the old copy after the shadow has caught up.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.feed(ctx, shadow, shadowLetters, progress); err != nil {
+		return err
+	}
+
+	checkpoint, err := shadow.Checkpoint(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := model.Swap(ctx, shadow); err != nil {
+		return err
+	}
+	r.advance()
+
+	if err := deadLetters.Swap(ctx, shadowLetters); err != nil {
+		return err
+	}
+
+	progress(Progress{Projection: r.name, Position: checkpoint, Head: checkpoint, Done: true})
+	return nil
+}
+
+// lockRebuild keeps other rebuilds and replays of dead letters, in this
+// and in other replicas, from running until unlock is called.
+func (r *Runner) lockRebuild(ctx context.Context) (context.Context, func(), error) {
+	inProgress := entity.Conflict(
+		"REBUILD_IN_PROGRESS",
+		fmt.Sprintf("projection %q is already being rebuilt or replaying dead letters", r.name),
+		map[string]string{"projection": r.name},
+	)
+
+	if !r.rebuilding.CompareAndSwap(false, true) {
+		return nil, nil, inProgress
+	}
+
+	locker, ok := r.model.(RebuildLocker)
+	if !ok {
+		return ctx, func() { r.rebuilding.Store(false) }, nil
+	}
+
+	locked, unlock, err := locker.LockRebuild(ctx)
+	if err != nil {
+		r.rebuilding.Store(false)
+		if errors.Is(err, ErrRebuildLocked) {
+			return nil, nil, inProgress
+		}
+		return nil, nil, err
+	}
+
+	return locked, func() {
+		unlock()
+		r.rebuilding.Store(false)
+	}, nil
+}
+
+// DeadLetters returns the events the Runner gave up on.
+func (r *Runner) DeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	return r.deadLetters.List(ctx)
+}
+
+// ReplayDeadLetters applies dead-lettered events to the live model
+// in the order of their positions and removes the letters of those
+// which are applied. Once an event fails again, the letters of
+// its aggregate are kept. If aggregateIds are given, only their
+// letters are replayed. It returns how many letters were replayed.
+//
+// It cannot run during a rebuild, which would swap in a copy of
+// the model without the replayed events.
+func (r *Runner) ReplayDeadLetters(ctx context.Context, aggregateIds []string) (int, error) {
+	ctx, unlock, err := r.lockRebuild(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.advance()
+
+	selected := make(map[string]bool, len(aggregateIds))
+	for _, id := range aggregateIds {
+		selected[id] = true
+	}
+	failed := make(map[string]bool)
+
+	replayed := 0
+	// Other replicas may dead-letter events of replayed
+	// aggregates meanwhile, which the next pass picks up.
+	for {
+		letters, err := r.deadLetters.List(ctx)
+		if err != nil {
+			return replayed, err
+		}
+
+		n := 0
+		for _, letter := range letters {
+			id := letter.Event.AggregateId
+			if failed[id] || (len(selected) > 0 && !selected[id]) {
+				continue
+			}
+
+			if err := r.apply(ctx, r.model, letter.Event); err != nil {
+				log.PrintLn("msg", "failed to replay dead letter", "projection", r.name, "aggregate_id", id, "version", letter.Event.Version, "position", letter.Event.Position, "err", err)
+
+				failed[id] = true
+				letter.Err = err.Error()
+				letter.Attempts++
+				letter.FailedAt = time.Now()
+				if err := r.deadLetters.Add(ctx, letter); err != nil {
+					return replayed, err
+				}
+				continue
+			}
+
+			if err := r.deadLetters.Remove(ctx, letter.Event.Position); err != nil {
+				return replayed, err
+			}
+			n++
+		}
+
+		replayed += n
+		if n == 0 {
+			return replayed, nil
+		}
+	}
+}
+
+// feed applies every event after the checkpoint of the model.
+// The checkpoint is read before every batch, since a rebuilt copy
+// of a Fenced model may be swapped in by another replica. A batch
+// interrupted by such a swap is read again from the new checkpoint.
+func (r *Runner) feed(ctx context.Context, model ReadModel, deadLetters DeadLetters, progress func(Progress)) error {
+batches:
+	for {
+		m, letters := model, deadLetters
+		if fenced, ok := model.(Fenced); ok {
+			var err error
+			if m, letters, err = fenced.Fence(ctx, deadLetters); err != nil {
+				return err
+			}
+		}
+
+		checkpoint, err := m.Checkpoint(ctx)
+		if err != nil {
+			return err
+		}
+
+		head, err := r.source.Head(ctx)
+		if err != nil {
+			return err
+		}
+
+		events, err := r.source.ReadAll(ctx, checkpoint, r.batchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(events) == 0 {
+			return nil
+		}
+
+		for _, event := range events {
+			err := r.project(ctx, m, letters, event)
+			if errors.Is(err, ErrSwapped) {
+				continue batches
+			}
+			if err != nil {
+				return err
+			}
+			checkpoint = event.Position
+		}
+
+		progress(Progress{Projection: r.name, Position: checkpoint, Head: head})
+	}
+}
+
+// errHalted is recorded for events which follow a dead letter of their aggregate.
+var errHalted = errors.New("an earlier event of the aggregate is dead-lettered")
+
+// project applies the event, retrying with a linear backoff.
+// Once the attempts are exhausted the event is dead-lettered and skipped.
+// Later events of its aggregate are dead-lettered without being applied,
+// since they could only fail on the missing version.
+func (r *Runner) project(ctx context.Context, model ReadModel, deadLetters DeadLetters, event cmd.Event) error {
+	halted, err := deadLetters.Halted(ctx, event.AggregateId, event.Position)
+	if err != nil {
+		return err
+	}
+	if halted {
+		return r.deadLetter(ctx, model, deadLetters, DeadLetter{
+			Event:    event,
+			Err:      errHalted.Error(),
+			FailedAt: time.Now(),
+		})
+	}
+
+	for attempt := 1; attempt <= r.maxAttempts; attempt++ {
+		if err = r.apply(ctx, model, event); err == nil || errors.Is(err, ErrSwapped) {
+			return err
+		}
+
+		if attempt == r.maxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * r.backoff):
+		}
+	}
+
+	log.PrintLn("msg", "dead-lettering event", "projection", r.name, "aggregate_id", event.AggregateId, "version", event.Version, "position", event.Position, "err", err)
+
+	return r.deadLetter(ctx, model, deadLetters, DeadLetter{
+		Event:    event,
+		Err:      err.Error(),
+		Attempts: r.maxAttempts,
+		FailedAt: time.Now(),
+	})
+}
+
+// deadLetter stores the letter before the checkpoint moves past its event,
+// so that a crash in between dead-letters the event again.
+func (r *Runner) deadLetter(ctx context.Context, model ReadModel, deadLetters DeadLetters, letter DeadLetter) error {
+	if err := deadLetters.Add(ctx, letter); err != nil {
+		return err
+	}
+	return model.SaveCheckpoint(ctx, letter.Event.Position)
+}
+
+func (r *Runner) apply(ctx context.Context, model ReadModel, event cmd.Event) error {
+	domainEvent, _, err := r.codec.Decode(event)
+	if err != nil {
+		return err
+	}
+	return model.Apply(ctx, domainEvent, event.Version, event.Position)
+}
@@ -0,0 +1,180 @@
+package query_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/idgen"
+	"github.com/krixlion/dev-forum_article/pkg/memory"
+	"github.com/krixlion/dev-forum_article/pkg/query"
+)
+
+func TestRunnerDeadLettersBadEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events := memory.NewEventStore(clock.System{})
+	codec := cmd.NewEventCodec(cmd.DefaultAggregateType, idgen.NewSequenceGenerator("event-"))
+	repo := cmd.NewRepository(events, codec)
+
+	if _, err := events.Append(ctx, "broken", 0, []cmd.Event{{Type: "ArticleCreated", Data: []byte("not a protobuf")}}); err != nil {
+		t.Fatalf("Failed to append, err: %v", err)
+	}
+
+	article, err := entity.NewArticle("article", "user", "title", "body", nil, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to create article, err: %v", err)
+	}
+	if _, err := repo.Save(ctx, &article, cmd.EventMetadata{}); err != nil {
+		t.Fatalf("Failed to save article, err: %v", err)
+	}
+
+	db := memory.NewDB()
+	deadLetters := memory.NewDeadLetters()
+	runner := query.NewRunner(events, codec, db, deadLetters,
+		query.WithRetry(3, time.Millisecond),
+		query.WithPollInterval(time.Millisecond),
+	)
+	go runner.Run(ctx)
+
+	for {
+		checkpoint, _ := db.Checkpoint(ctx)
+		head, _ := events.Head(ctx)
+		if checkpoint == head {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("Runner did not catch up, checkpoint: %v", checkpoint)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	letters, _ := deadLetters.List(ctx)
+	if len(letters) != 1 || letters[0].Event.AggregateId != "broken" || letters[0].Attempts != 3 {
+		t.Fatalf("Unexpected dead letters: %+v", letters)
+	}
+
+	got, err := db.Get(ctx, "article")
+	if err != nil {
+		t.Fatalf("Event after the bad one was not projected, err: %v", err)
+	}
+	if got.Title != "title" || got.Version != 1 {
+		t.Fatalf("Unexpected article: %+v", got)
+	}
+}
+
+// flakyDB fails to apply the first version of an article while broken is set.
+type flakyDB struct {
+	*memory.DB
+	broken atomic.Bool
+}
+
+func (db *flakyDB) Apply(ctx context.Context, event entity.Event, version, position int64) error {
+	if version == 1 && db.broken.Load() {
+		return errors.New("broken")
+	}
+	return db.DB.Apply(ctx, event, version, position)
+}
+
+func TestRunnerHaltsAggregatesUntilReplayed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events := memory.NewEventStore(clock.System{})
+	codec := cmd.NewEventCodec(cmd.DefaultAggregateType, idgen.NewSequenceGenerator("event-"))
+	repo := cmd.NewRepository(events, codec)
+
+	article, err := entity.NewArticle("article", "user", "title", "body", nil, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to create article, err: %v", err)
+	}
+	if err := article.Rename("renamed", time.Now()); err != nil {
+		t.Fatalf("Failed to rename article, err: %v", err)
+	}
+	if _, err := repo.Save(ctx, &article, cmd.EventMetadata{}); err != nil {
+		t.Fatalf("Failed to save article, err: %v", err)
+	}
+
+	db := &flakyDB{DB: memory.NewDB()}
+	db.broken.Store(true)
+	deadLetters := memory.NewDeadLetters()
+	runner := query.NewRunner(events, codec, db, deadLetters, query.WithRetry(2, time.Millisecond))
+
+	go runner.Run(ctx)
+	if err := runner.WaitFor(ctx, 2); err != nil {
+		t.Fatalf("Runner did not catch up, err: %v", err)
+	}
+
+	// The rename is not retried on a version gap, it waits for the creation.
+	letters, _ := deadLetters.List(ctx)
+	if len(letters) != 2 || letters[0].Attempts != 2 || letters[1].Attempts != 0 || letters[1].Event.Version != 2 {
+		t.Fatalf("Unexpected dead letters: %+v", letters)
+	}
+
+	db.broken.Store(false)
+	replayed, err := runner.ReplayDeadLetters(ctx, nil)
+	if err != nil || replayed != 2 {
+		t.Fatalf("Failed to replay dead letters, replayed: %v, err: %v", replayed, err)
+	}
+
+	if letters, _ := deadLetters.List(ctx); len(letters) != 0 {
+		t.Fatalf("Replayed dead letters were kept: %+v", letters)
+	}
+
+	got, err := db.Get(ctx, "article")
+	if err != nil || got.Title != "renamed" || got.Version != 2 {
+		t.Fatalf("Unexpected article: %+v, err: %v", got, err)
+	}
+}
+
+func TestRebuildKeepsDeadLettersOfTheCopy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events := memory.NewEventStore(clock.System{})
+	codec := cmd.NewEventCodec(cmd.DefaultAggregateType, idgen.NewSequenceGenerator("event-"))
+	repo := cmd.NewRepository(events, codec)
+
+	article, err := entity.NewArticle("article", "user", "title", "body", nil, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to create article, err: %v", err)
+	}
+	if _, err := repo.Save(ctx, &article, cmd.EventMetadata{}); err != nil {
+		t.Fatalf("Failed to save article, err: %v", err)
+	}
+	if _, err := events.Append(ctx, "broken", 0, []cmd.Event{{Type: "ArticleCreated", Data: []byte("not a protobuf")}}); err != nil {
+		t.Fatalf("Failed to append, err: %v", err)
+	}
+
+	// The live model fails on the article, the shadow copy is not flaky.
+	db := &flakyDB{DB: memory.NewDB()}
+	db.broken.Store(true)
+	deadLetters := memory.NewDeadLetters()
+	runner := query.NewRunner(events, codec, db, deadLetters, query.WithRetry(2, time.Millisecond))
+
+	go runner.Run(ctx)
+	if err := runner.WaitFor(ctx, 2); err != nil {
+		t.Fatalf("Runner did not catch up, err: %v", err)
+	}
+	if letters, _ := deadLetters.List(ctx); len(letters) != 2 {
+		t.Fatalf("Unexpected dead letters: %+v", letters)
+	}
+
+	if err := runner.Rebuild(ctx, func(query.Progress) {}); err != nil {
+		t.Fatalf("Failed to rebuild, err: %v", err)
+	}
+
+	if got, err := db.Get(ctx, "article"); err != nil || got.Title != "title" {
+		t.Fatalf("Article halted in the live model was not rebuilt: %+v, err: %v", got, err)
+	}
+	letters, _ := deadLetters.List(ctx)
+	if len(letters) != 1 || letters[0].Event.AggregateId != "broken" {
+		t.Fatalf("Dead letters of the copy were not swapped in: %+v", letters)
+	}
+}
@@ -1 +1,14 @@
 package query
+
+import (
+	"context"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+)
+
+// Storage is the read side of the article repository.
+type Storage interface {
+	Get(ctx context.Context, id string) (entity.Article, error)
+	List(ctx context.Context, params ListParams) (Page[entity.Article], error)
+	Close() error
+}
@@ -0,0 +1,183 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+)
+
+// EventStore is a cmd.EventStore and a cmd.Outbox. The events table
+// doubles as the outbox, so events are queued for publishing
+// in the transaction which appends them.
+type EventStore struct {
+	db    *sql.DB
+	clock clock.Clock
+}
+
+// NewEventStore expects db to be migrated by NewWriteMigrator.
+// It takes ownership of db, which is closed by Close.
+func NewEventStore(db *sql.DB, clock clock.Clock) *EventStore {
+	return &EventStore{
+		db:    db,
+		clock: clock,
+	}
+}
+
+func (s *EventStore) Append(ctx context.Context, aggregateId string, expectedVersion int64, events []cmd.Event) ([]cmd.Event, error) {
+	return s.AppendAndScrub(ctx, aggregateId, expectedVersion, events, nil)
+}
+
+// AppendAndScrub updates the events in the transaction which appends.
+// Pages freed by the update are zeroed, as databases are opened
+// with secure_delete, and the WAL drops them on its next checkpoint.
+func (s *EventStore) AppendAndScrub(ctx context.Context, aggregateId string, expectedVersion int64, events []cmd.Event, data map[int64][]byte) ([]cmd.Event, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var version int64
+	row := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM events WHERE aggregate_id = ?`, aggregateId)
+	if err := row.Scan(&version); err != nil {
+		return nil, err
+	}
+
+	if version != expectedVersion {
+		return nil, cmd.ConcurrencyConflict(aggregateId, expectedVersion, version)
+	}
+
+	if len(events) == 0 && len(data) == 0 {
+		return nil, nil
+	}
+
+	if err := scrub(ctx, tx, aggregateId, data); err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	appended := make([]cmd.Event, 0, len(events))
+	for i, event := range events {
+		event.AggregateId = aggregateId
+		event.Version = expectedVersion + int64(i) + 1
+		event.RecordedAt = now
+
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO events (id, aggregate_id, version, type, data, recorded_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			event.Id, event.AggregateId, event.Version, event.Type, event.Data, event.RecordedAt.UnixNano(),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if event.Position, err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+		appended = append(appended, event)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return appended, nil
+}
+
+// scrub replaces the data of the events at the versions given as keys.
+func scrub(ctx context.Context, tx *sql.Tx, aggregateId string, data map[int64][]byte) error {
+	for version, d := range data {
+		res, err := tx.ExecContext(ctx, `UPDATE events SET data = ? WHERE aggregate_id = ? AND version = ?`, d, aggregateId, version)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n != 1 {
+			return fmt.Errorf("event %d of %q does not exist", version, aggregateId)
+		}
+	}
+
+	return nil
+}
+
+const eventColumns = `id, aggregate_id, version, position, type, data, recorded_at`
+
+func (s *EventStore) Load(ctx context.Context, aggregateId string, fromVersion int64) ([]cmd.Event, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+eventColumns+` FROM events WHERE aggregate_id = ? AND version >= ? ORDER BY version`,
+		aggregateId, fromVersion,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+func (s *EventStore) ReadAll(ctx context.Context, afterPosition int64, limit int) ([]cmd.Event, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+eventColumns+` FROM events WHERE position > ? ORDER BY position LIMIT ?`,
+		afterPosition, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+func scanEvents(rows *sql.Rows) ([]cmd.Event, error) {
+	defer rows.Close()
+
+	var events []cmd.Event
+	for rows.Next() {
+		var event cmd.Event
+		var recordedAt int64
+		if err := rows.Scan(&event.Id, &event.AggregateId, &event.Version, &event.Position, &event.Type, &event.Data, &recordedAt); err != nil {
+			return nil, err
+		}
+		event.RecordedAt = time.Unix(0, recordedAt).UTC()
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (s *EventStore) Head(ctx context.Context) (int64, error) {
+	var head int64
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(position), 0) FROM events`).Scan(&head)
+	return head, err
+}
+
+func (s *EventStore) Unsent(ctx context.Context, limit int) ([]cmd.Event, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+eventColumns+` FROM events WHERE position > (SELECT sent FROM outbox WHERE id = 1) ORDER BY position LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+func (s *EventStore) MarkSent(ctx context.Context, position int64) error {
+	head, err := s.Head(ctx)
+	if err != nil {
+		return err
+	}
+	if position > head {
+		return fmt.Errorf("cannot mark position %d as sent, head is at %d", position, head)
+	}
+
+	_, err = s.db.ExecContext(ctx, `UPDATE outbox SET sent = MAX(sent, ?) WHERE id = 1`, position)
+	return err
+}
+
+func (s *EventStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,44 @@
+package sqlite
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"github.com/krixlion/dev-forum_article/pkg/migrate"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// Tables the migrations of both databases are recorded in,
+// which may be the same file.
+const (
+	WriteMigrationsTable = "event_store_migrations"
+	ReadMigrationsTable  = "read_model_migrations"
+)
+
+// Dialect relies on transactions taking the write lock of
+// the whole database when they begin, which Open makes them do.
+var Dialect = migrate.Dialect{
+	Placeholder: func(int) string { return "?" },
+}
+
+// NewWriteMigrator migrates the database of the EventStore and Snapshots.
+func NewWriteMigrator(db *sql.DB, opts ...migrate.Option) (*migrate.Migrator, error) {
+	return newMigrator(db, "migrations/write", WriteMigrationsTable, opts)
+}
+
+// NewReadMigrator migrates the database of the ReadModel.
+func NewReadMigrator(db *sql.DB, opts ...migrate.Option) (*migrate.Migrator, error) {
+	return newMigrator(db, "migrations/read", ReadMigrationsTable, opts)
+}
+
+func newMigrator(db *sql.DB, dir, table string, opts []migrate.Option) (*migrate.Migrator, error) {
+	fsys, err := fs.Sub(migrations, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(db, fsys, Dialect, append([]migrate.Option{migrate.WithTable(table)}, opts...)...)
+}
@@ -0,0 +1,39 @@
+-- Tags are kept as a JSON array, times as Unix nanoseconds.
+CREATE TABLE articles (
+	id           TEXT PRIMARY KEY,
+	user_id      TEXT    NOT NULL,
+	title        TEXT    NOT NULL,
+	body         TEXT    NOT NULL,
+	tags         TEXT    NOT NULL,
+	version      INTEGER NOT NULL,
+	created_at   INTEGER,
+	updated_at   INTEGER,
+	published_at INTEGER,
+	deleted_at   INTEGER,
+	purged       INTEGER NOT NULL
+);
+
+CREATE INDEX articles_created_at ON articles (created_at, id);
+CREATE INDEX articles_updated_at ON articles (updated_at, id);
+CREATE INDEX articles_user_id ON articles (user_id);
+
+-- Projections are rebuilt into the shadow table, which
+-- must be changed by every migration changing articles.
+CREATE TABLE articles_shadow (
+	id           TEXT PRIMARY KEY,
+	user_id      TEXT    NOT NULL,
+	title        TEXT    NOT NULL,
+	body         TEXT    NOT NULL,
+	tags         TEXT    NOT NULL,
+	version      INTEGER NOT NULL,
+	created_at   INTEGER,
+	updated_at   INTEGER,
+	published_at INTEGER,
+	deleted_at   INTEGER,
+	purged       INTEGER NOT NULL
+);
+
+CREATE TABLE checkpoints (
+	model    TEXT PRIMARY KEY,
+	position INTEGER NOT NULL
+);
@@ -0,0 +1,19 @@
+-- Events the projection gave up on, which are behind the checkpoint
+-- until they are replayed. Times are kept as Unix nanoseconds.
+-- The letters of every copy of a model are kept apart by its table.
+CREATE TABLE dead_letters (
+	model        TEXT    NOT NULL,
+	position     INTEGER NOT NULL,
+	id           TEXT    NOT NULL,
+	aggregate_id TEXT    NOT NULL,
+	version      INTEGER NOT NULL,
+	type         TEXT    NOT NULL,
+	data         BLOB,
+	recorded_at  INTEGER NOT NULL,
+	err          TEXT    NOT NULL,
+	attempts     INTEGER NOT NULL,
+	failed_at    INTEGER NOT NULL,
+	PRIMARY KEY (model, position)
+);
+
+CREATE INDEX dead_letters_aggregate_id ON dead_letters (model, aggregate_id, position);
@@ -0,0 +1,3 @@
+DROP TABLE snapshots;
+DROP TABLE outbox;
+DROP TABLE events;
@@ -0,0 +1,25 @@
+-- Times are kept as Unix nanoseconds.
+CREATE TABLE events (
+	position     INTEGER PRIMARY KEY AUTOINCREMENT,
+	id           TEXT    NOT NULL,
+	aggregate_id TEXT    NOT NULL,
+	version      INTEGER NOT NULL,
+	type         TEXT    NOT NULL,
+	data         BLOB,
+	recorded_at  INTEGER NOT NULL,
+	UNIQUE (aggregate_id, version)
+);
+
+CREATE TABLE outbox (
+	id   INTEGER PRIMARY KEY CHECK (id = 1),
+	sent INTEGER NOT NULL
+);
+
+INSERT INTO outbox (id, sent) VALUES (1, 0);
+
+CREATE TABLE snapshots (
+	aggregate_id   TEXT PRIMARY KEY,
+	version        INTEGER NOT NULL,
+	schema_version INTEGER NOT NULL,
+	data           BLOB    NOT NULL
+);
@@ -0,0 +1,104 @@
+// Package sqlite implements the event store on SQLite databases
+// kept in local files, along with the read model and the snapshots
+// of package sqlstore.
+//
+// Databases are opened with the pure-Go driver modernc.org/sqlite,
+// so binaries do not need cgo.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	// Registers itself as DriverName.
+	_ "modernc.org/sqlite"
+)
+
+// DriverName is the name the driver is registered under.
+const DriverName = "sqlite"
+
+const (
+	DefaultMaxOpenConns    = 4
+	DefaultMaxIdleConns    = 4
+	DefaultConnMaxLifetime = time.Hour
+	DefaultBusyTimeout     = 5 * time.Second
+)
+
+type config struct {
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	busyTimeout     time.Duration
+}
+
+type Option func(*config)
+
+// WithMaxOpenConns limits the size of the connection pool. SQLite allows
+// a single writer at a time, so databases which are mostly written
+// gain nothing from more than one connection.
+func WithMaxOpenConns(n int) Option {
+	return func(c *config) {
+		c.maxOpenConns = n
+	}
+}
+
+// WithMaxIdleConns sets how many connections are kept open when idle.
+func WithMaxIdleConns(n int) Option {
+	return func(c *config) {
+		c.maxIdleConns = n
+	}
+}
+
+// WithConnMaxLifetime sets after how long connections are reopened.
+func WithConnMaxLifetime(d time.Duration) Option {
+	return func(c *config) {
+		c.connMaxLifetime = d
+	}
+}
+
+// WithBusyTimeout sets how long a connection waits
+// for another one to release the write lock.
+func WithBusyTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.busyTimeout = d
+	}
+}
+
+// Open opens the database in the file at path, creating it if needed.
+// The database is switched to WAL mode, so that readers do not block
+// the writer, and transactions take the write lock when they begin,
+// so that concurrent read-modify-write transactions wait for each
+// other instead of failing on commit.
+func Open(ctx context.Context, path string, opts ...Option) (*sql.DB, error) {
+	c := config{
+		maxOpenConns:    DefaultMaxOpenConns,
+		maxIdleConns:    DefaultMaxIdleConns,
+		connMaxLifetime: DefaultConnMaxLifetime,
+		busyTimeout:     DefaultBusyTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	dsn := fmt.Sprintf("%s?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=foreign_keys(ON)&_pragma=secure_delete(ON)&_pragma=busy_timeout(%d)&_txlock=immediate",
+		path, c.busyTimeout.Milliseconds())
+
+	db, err := sql.Open(DriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(c.maxOpenConns)
+	db.SetMaxIdleConns(c.maxIdleConns)
+	db.SetConnMaxLifetime(c.connMaxLifetime)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,291 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/migrate"
+	"github.com/krixlion/dev-forum_article/pkg/query"
+	"github.com/krixlion/dev-forum_article/pkg/sqlite"
+	"github.com/krixlion/dev-forum_article/pkg/sqlstore"
+	"github.com/krixlion/dev-forum_article/pkg/storagetest"
+)
+
+type newMigrator func(*sql.DB, ...migrate.Option) (*migrate.Migrator, error)
+
+func openMigrated(t *testing.T, name string, newMigrator newMigrator) *sql.DB {
+	t.Helper()
+
+	db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), name))
+	if err != nil {
+		t.Fatalf("Failed to open database, err: %v", err)
+	}
+
+	migrator, err := newMigrator(db)
+	if err != nil {
+		t.Fatalf("Failed to load migrations, err: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate, err: %v", err)
+	}
+
+	return db
+}
+
+func TestMigrationsRunOnceAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "shared.db")
+
+	// Both databases share the file, as they may in production.
+	var wg sync.WaitGroup
+	applied := make([]int, 4)
+	for i := range applied {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			db, err := sqlite.Open(ctx, path, sqlite.WithMaxOpenConns(1))
+			if err != nil {
+				t.Errorf("Failed to open database, err: %v", err)
+				return
+			}
+			defer db.Close()
+
+			for _, newMigrator := range []newMigrator{sqlite.NewWriteMigrator, sqlite.NewReadMigrator} {
+				migrator, err := newMigrator(db)
+				if err != nil {
+					t.Errorf("Failed to load migrations, err: %v", err)
+					return
+				}
+				done, err := migrator.Up(ctx)
+				if err != nil {
+					t.Errorf("Failed to migrate, err: %v", err)
+					return
+				}
+				applied[i] += len(done)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, n := range applied {
+		total += n
+	}
+	if total != 4 {
+		t.Fatalf("Migrations were not applied exactly once, applied: %v", applied)
+	}
+
+	db, err := sqlite.Open(ctx, path)
+	if err != nil {
+		t.Fatalf("Failed to open database, err: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := sqlite.NewReadMigrator(db)
+	if err != nil {
+		t.Fatalf("Failed to load migrations, err: %v", err)
+	}
+
+	reverted, err := migrator.Down(ctx, 3)
+	if err != nil || len(reverted) != 3 {
+		t.Fatalf("Failed to revert, reverted: %v, err: %v", reverted, err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read status, err: %v", err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("Unexpected status: %+v", statuses)
+	}
+	for _, status := range statuses {
+		if status.Applied {
+			t.Fatalf("Migration was not reverted: %+v", status)
+		}
+	}
+
+	// The events must survive reverting the read model.
+	if _, err := sqlite.NewEventStore(db, clock.System{}).Head(ctx); err != nil {
+		t.Fatalf("Write schema was reverted, err: %v", err)
+	}
+}
+
+func TestEventStore(t *testing.T) {
+	storagetest.TestEventStore(t, func(t *testing.T) storagetest.EventStore {
+		return sqlite.NewEventStore(openMigrated(t, "write.db", sqlite.NewWriteMigrator), clock.System{})
+	})
+}
+
+func TestSnapshots(t *testing.T) {
+	storagetest.TestSnapshotStore(t, func(t *testing.T) cmd.SnapshotStore {
+		db := openMigrated(t, "write.db", sqlite.NewWriteMigrator)
+		t.Cleanup(func() { db.Close() })
+		return sqlite.NewSnapshots(db)
+	})
+}
+
+func TestReadModel(t *testing.T) {
+	storagetest.TestReadModel(t, func(t *testing.T) storagetest.ReadModel {
+		return sqlite.NewReadModel(openMigrated(t, "read.db", sqlite.NewReadMigrator))
+	})
+}
+
+func TestDeadLetters(t *testing.T) {
+	storagetest.TestDeadLetters(t, func(t *testing.T) query.DeadLetters {
+		db := openMigrated(t, "read.db", sqlite.NewReadMigrator)
+		t.Cleanup(func() { db.Close() })
+		return sqlite.NewDeadLetters(db)
+	})
+}
+
+// openReplica opens the read model at path as a replica of the service would.
+func openReplica(t *testing.T, path string, opts ...sqlstore.Option) (*sqlstore.ReadModel, *sqlstore.DeadLetters) {
+	t.Helper()
+	ctx := context.Background()
+
+	db, err := sqlite.Open(ctx, path)
+	if err != nil {
+		t.Fatalf("Failed to open database, err: %v", err)
+	}
+	migrator, err := sqlite.NewReadMigrator(db)
+	if err != nil {
+		t.Fatalf("Failed to load migrations, err: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Failed to migrate, err: %v", err)
+	}
+
+	model := sqlite.NewReadModel(db, opts...)
+	t.Cleanup(func() { model.Close() })
+	return model, sqlite.NewDeadLetters(db)
+}
+
+func TestRebuildsAreLockedAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "read.db")
+
+	a, _ := openReplica(t, path)
+	// b sees every lease as expired after the first look at its clock.
+	b, _ := openReplica(t, path, sqlstore.WithClock(clock.NewStepping(time.Now(), time.Hour)))
+
+	_, unlockA, err := a.LockRebuild(ctx)
+	if err != nil {
+		t.Fatalf("Failed to lock rebuilds, err: %v", err)
+	}
+	defer unlockA()
+
+	if _, err := b.Shadow(ctx); err == nil {
+		t.Fatal("Shadow was emptied without the lock")
+	}
+
+	if _, _, err := b.LockRebuild(ctx); !errors.Is(err, query.ErrRebuildLocked) {
+		t.Fatalf("Rebuilds were locked twice, err: %v", err)
+	}
+
+	_, unlockB, err := b.LockRebuild(ctx)
+	if err != nil {
+		t.Fatalf("Expired lock was not taken over, err: %v", err)
+	}
+
+	if _, err := a.Shadow(ctx); err == nil {
+		t.Fatal("Shadow was emptied after the lock was taken over")
+	}
+	shadow, err := b.Shadow(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create shadow, err: %v", err)
+	}
+	if err := b.Swap(ctx, shadow); err != nil {
+		t.Fatalf("Failed to swap, err: %v", err)
+	}
+
+	unlockB()
+	if _, unlock, err := a.LockRebuild(ctx); err != nil {
+		t.Fatalf("Released lock was not taken, err: %v", err)
+	} else {
+		unlock()
+	}
+}
+
+func TestSwapFencesOtherReplicas(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "read.db")
+	created := func(id string) entity.ArticleCreated {
+		return entity.ArticleCreated{ArticleId: id, UserId: "user", Title: "title", Body: "body", At: time.Now()}
+	}
+	letter := func(aggregateId string, position int64) query.DeadLetter {
+		return query.DeadLetter{Event: cmd.Event{Id: aggregateId, AggregateId: aggregateId, Version: 1, Position: position}, FailedAt: time.Now()}
+	}
+
+	a, aLetters := openReplica(t, path)
+	b, bLetters := openReplica(t, path)
+
+	model, letters, err := b.Fence(ctx, bLetters)
+	if err != nil {
+		t.Fatalf("Failed to fence the model, err: %v", err)
+	}
+	if err := model.Apply(ctx, created("a"), 1, 1); err != nil {
+		t.Fatalf("Failed to apply, err: %v", err)
+	}
+	if err := letters.Add(ctx, letter("live", 2)); err != nil {
+		t.Fatalf("Failed to add dead letter, err: %v", err)
+	}
+
+	locked, unlock, err := a.LockRebuild(ctx)
+	if err != nil {
+		t.Fatalf("Failed to lock rebuilds, err: %v", err)
+	}
+	defer unlock()
+
+	shadow, err := a.Shadow(locked)
+	if err != nil {
+		t.Fatalf("Failed to create shadow, err: %v", err)
+	}
+	shadowLetters, err := aLetters.Shadow(locked, shadow)
+	if err != nil {
+		t.Fatalf("Failed to create shadow dead letters, err: %v", err)
+	}
+	if err := shadowLetters.Add(locked, letter("rebuilt", 3)); err != nil {
+		t.Fatalf("Failed to add dead letter, err: %v", err)
+	}
+	if halted, err := shadowLetters.Halted(locked, "live", 10); err != nil || halted {
+		t.Fatalf("Shadow sees live dead letters, halted: %v, err: %v", halted, err)
+	}
+	if err := a.Swap(locked, shadow); err != nil {
+		t.Fatalf("Failed to swap, err: %v", err)
+	}
+	if err := aLetters.Swap(locked, shadowLetters); err != nil {
+		t.Fatalf("Failed to swap dead letters, err: %v", err)
+	}
+
+	if err := model.Apply(ctx, created("b"), 1, 4); !errors.Is(err, query.ErrSwapped) {
+		t.Fatalf("Event was applied to the swapped model, err: %v", err)
+	}
+	if err := model.SaveCheckpoint(ctx, 4); !errors.Is(err, query.ErrSwapped) {
+		t.Fatalf("Checkpoint of the swapped model was moved, err: %v", err)
+	}
+	if err := letters.Add(ctx, letter("b", 4)); !errors.Is(err, query.ErrSwapped) {
+		t.Fatalf("Event was dead-lettered in the swapped model, err: %v", err)
+	}
+
+	got, err := bLetters.List(ctx)
+	if err != nil || len(got) != 1 || got[0].Event.AggregateId != "rebuilt" {
+		t.Fatalf("Dead letters of the shadow were not swapped in: %+v, err: %v", got, err)
+	}
+
+	model, _, err = b.Fence(ctx, bLetters)
+	if err != nil {
+		t.Fatalf("Failed to fence the model, err: %v", err)
+	}
+	if err := model.Apply(ctx, created("b"), 1, 4); err != nil {
+		t.Fatalf("Failed to apply after fencing again, err: %v", err)
+	}
+}
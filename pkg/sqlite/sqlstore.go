@@ -0,0 +1,35 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/krixlion/dev-forum_article/pkg/sqlstore"
+)
+
+// storeDialect relies on transactions taking the write lock of
+// the whole database when they begin, which Open makes them do.
+var storeDialect = sqlstore.Dialect{
+	Placeholder: func(int) string { return "?" },
+	Greatest:    "MAX",
+	HasTag: func(placeholder string) string {
+		return "EXISTS (SELECT 1 FROM json_each(tags) WHERE json_each.value = " + placeholder + ")"
+	},
+}
+
+// NewReadModel expects db to be migrated by NewReadMigrator.
+// It takes ownership of db, which is closed by Close.
+func NewReadModel(db *sql.DB, opts ...sqlstore.Option) *sqlstore.ReadModel {
+	return sqlstore.NewReadModel(db, storeDialect, opts...)
+}
+
+// NewDeadLetters expects db to be migrated by NewReadMigrator.
+// It does not take ownership of db.
+func NewDeadLetters(db *sql.DB) *sqlstore.DeadLetters {
+	return sqlstore.NewDeadLetters(db, storeDialect)
+}
+
+// NewSnapshots expects db to be migrated by NewWriteMigrator.
+// It does not take ownership of db.
+func NewSnapshots(db *sql.DB) *sqlstore.Snapshots {
+	return sqlstore.NewSnapshots(db, storeDialect)
+}
@@ -0,0 +1,128 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/query"
+)
+
+// DeadLetters is a query.DeadLetters kept in the database of the read model,
+// next to the checkpoint which moves past the events it holds.
+// The letters of the shadow copy of the model are kept apart,
+// they replace the live ones when ReadModel.Swap swaps it in.
+type DeadLetters struct {
+	db      *sql.DB
+	dialect Dialect
+	// model names the table of the model the letters belong to.
+	model string
+	// generation is set on letters returned by ReadModel.Fence.
+	generation *int64
+}
+
+// NewDeadLetters expects db to hold the dead_letters table.
+// It does not take ownership of db.
+func NewDeadLetters(db *sql.DB, dialect Dialect) *DeadLetters {
+	return &DeadLetters{
+		db:      db,
+		dialect: dialect,
+		model:   liveTable,
+	}
+}
+
+func (d *DeadLetters) Add(ctx context.Context, letter query.DeadLetter) error {
+	tx, err := begin(ctx, d.db, d.dialect, d.model, d.generation)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	event := letter.Event
+
+	p := d.dialect.Placeholder
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO dead_letters (model, position, id, aggregate_id, version, type, data, recorded_at, err, attempts, failed_at)
+		VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)
+		ON CONFLICT (model, position) DO UPDATE SET
+			err = excluded.err,
+			attempts = excluded.attempts,
+			failed_at = excluded.failed_at`, p(1), p(2), p(3), p(4), p(5), p(6), p(7), p(8), p(9), p(10), p(11)),
+		d.model, event.Position, event.Id, event.AggregateId, event.Version, event.Type, event.Data,
+		event.RecordedAt.UnixNano(), letter.Err, letter.Attempts, letter.FailedAt.UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *DeadLetters) List(ctx context.Context) ([]query.DeadLetter, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT position, id, aggregate_id, version, type, data, recorded_at, err, attempts, failed_at
+		FROM dead_letters WHERE model = `+d.dialect.Placeholder(1)+` ORDER BY position`, d.model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var letters []query.DeadLetter
+	for rows.Next() {
+		var event cmd.Event
+		var letter query.DeadLetter
+		var recordedAt, failedAt int64
+		if err := rows.Scan(
+			&event.Position, &event.Id, &event.AggregateId, &event.Version, &event.Type, &event.Data,
+			&recordedAt, &letter.Err, &letter.Attempts, &failedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		event.RecordedAt = time.Unix(0, recordedAt).UTC()
+		letter.Event = event
+		letter.FailedAt = time.Unix(0, failedAt).UTC()
+		letters = append(letters, letter)
+	}
+
+	return letters, rows.Err()
+}
+
+func (d *DeadLetters) Halted(ctx context.Context, aggregateId string, position int64) (bool, error) {
+	p := d.dialect.Placeholder
+
+	var halted bool
+	err := d.db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT EXISTS (SELECT 1 FROM dead_letters WHERE model = %s AND aggregate_id = %s AND position < %s)`, p(1), p(2), p(3)),
+		d.model, aggregateId, position,
+	).Scan(&halted)
+	return halted, err
+}
+
+func (d *DeadLetters) Remove(ctx context.Context, position int64) error {
+	p := d.dialect.Placeholder
+	_, err := d.db.ExecContext(ctx, `DELETE FROM dead_letters WHERE model = `+p(1)+` AND position = `+p(2), d.model, position)
+	return err
+}
+
+// Shadow returns the letters of a shadow returned by ReadModel.Shadow,
+// which also deletes the letters left by an interrupted rebuild.
+func (d *DeadLetters) Shadow(_ context.Context, shadow query.ReadModel) (query.DeadLetters, error) {
+	s, ok := shadow.(*ReadModel)
+	if !ok || s.table != shadowTable {
+		return nil, fmt.Errorf("cannot keep dead letters of %T", shadow)
+	}
+
+	return &DeadLetters{db: d.db, dialect: d.dialect, model: s.table}, nil
+}
+
+// Swap only checks the letters, ReadModel.Swap already moved
+// them in the transaction which swapped in the shadow.
+func (d *DeadLetters) Swap(_ context.Context, shadow query.DeadLetters) error {
+	if s, ok := shadow.(*DeadLetters); !ok || s.model != shadowTable {
+		return fmt.Errorf("cannot swap in %T", shadow)
+	}
+	return nil
+}
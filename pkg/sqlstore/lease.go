@@ -0,0 +1,159 @@
+package sqlstore
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/krixlion/dev-forum_article/pkg/log"
+	"github.com/krixlion/dev-forum_article/pkg/query"
+)
+
+// DefaultLeaseTTL is how long the lock of rebuilds outlives
+// a replica which stopped renewing it, e.g. because it crashed.
+const DefaultLeaseTTL = 30 * time.Second
+
+// rebuildLease names the lease of rebuilds in the leases table.
+const rebuildLease = "rebuild:" + liveTable
+
+// errLeaseLost is returned by Shadow and Swap
+// when the lease of rebuilds is not held.
+var errLeaseLost = errors.New("the lock of rebuilds is not held")
+
+// LockRebuild takes the lease of rebuilds, which the database
+// keeps for every replica. It is renewed in the background until
+// unlock is called. If it cannot be renewed before it expires,
+// the returned context is cancelled.
+func (m *ReadModel) LockRebuild(ctx context.Context) (context.Context, func(), error) {
+	owner, err := newOwner()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ok, err := m.takeLease(ctx, m.db, owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, query.ErrRebuildLocked
+	}
+
+	m.leaseMu.Lock()
+	m.leaseOwner = owner
+	m.leaseMu.Unlock()
+
+	locked, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.renewLease(locked, cancel, owner)
+	}()
+
+	unlock := func() {
+		cancel()
+		<-done
+
+		m.leaseMu.Lock()
+		m.leaseOwner = ""
+		m.leaseMu.Unlock()
+
+		p := m.dialect.Placeholder
+		if _, err := m.db.ExecContext(context.Background(), `DELETE FROM leases WHERE name = `+p(1)+` AND owner = `+p(2), rebuildLease, owner); err != nil {
+			log.PrintLn("msg", "failed to release the lock of rebuilds", "err", err)
+		}
+	}
+
+	return locked, unlock, nil
+}
+
+func newOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// takeLease takes the lease if it is free or expired, or extends it
+// if owner already holds it. It reports whether owner holds it.
+func (m *ReadModel) takeLease(ctx context.Context, db execer, owner string) (bool, error) {
+	now := m.clock.Now()
+
+	p := m.dialect.Placeholder
+	result, err := db.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO leases (name, owner, expires_at) VALUES (%s, %s, %s)
+		ON CONFLICT (name) DO UPDATE SET
+			owner = excluded.owner,
+			expires_at = excluded.expires_at
+		WHERE leases.owner = excluded.owner OR leases.expires_at < %s`, p(1), p(2), p(3), p(4)),
+		rebuildLease, owner, now.Add(m.leaseTTL).UnixNano(), now.UnixNano(),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// renewLease extends the lease a few times per TTL until ctx is cancelled.
+// It calls cancel once the lease is taken over or may have expired.
+func (m *ReadModel) renewLease(ctx context.Context, cancel func(), owner string) {
+	ticker := time.NewTicker(m.leaseTTL / 3)
+	defer ticker.Stop()
+
+	renewed := m.clock.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ok, err := m.takeLease(ctx, m.db, owner)
+		switch {
+		case err == nil && ok:
+			renewed = m.clock.Now()
+			continue
+		case err == nil:
+			log.PrintLn("msg", "lost the lock of rebuilds to another replica")
+		case m.clock.Now().Sub(renewed) < m.leaseTTL:
+			log.PrintLn("msg", "failed to renew the lock of rebuilds", "err", err)
+			continue
+		default:
+			log.PrintLn("msg", "the lock of rebuilds expired", "err", err)
+		}
+
+		cancel()
+		return
+	}
+}
+
+// fence renews the lease of rebuilds in tx, so that no other
+// replica can take it over until tx ends.
+func (m *ReadModel) fence(ctx context.Context, tx *sql.Tx) error {
+	m.leaseMu.Lock()
+	owner := m.leaseOwner
+	m.leaseMu.Unlock()
+
+	if owner == "" {
+		return errLeaseLost
+	}
+
+	ok, err := m.takeLease(ctx, tx, owner)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errLeaseLost
+	}
+	return nil
+}
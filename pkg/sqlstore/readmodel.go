@@ -0,0 +1,479 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/clock"
+	"github.com/krixlion/dev-forum_article/pkg/query"
+)
+
+const (
+	liveTable   = "articles"
+	shadowTable = "articles_shadow"
+)
+
+// ReadModel is a query.Rebuildable read model. It also implements
+// cmd.TombstoneFinder, since it keeps deleted articles until they are purged.
+// Its checkpoint is stored in the same transaction as every applied event.
+//
+// Replicas sharing the database may project the same events
+// at the same time, events are applied to a table under
+// the lock of the Dialect. Only one of them may rebuild
+// the model at a time, see LockRebuild.
+type ReadModel struct {
+	db      *sql.DB
+	dialect Dialect
+	// table holds the articles, it also names the checkpoint
+	// and the dead letters of the model.
+	table string
+	// generation is set on models returned by Fence.
+	generation *int64
+	clock      clock.Clock
+	leaseTTL   time.Duration
+	leaseMu    sync.Mutex
+	// leaseOwner identifies the lease of rebuilds while it is held.
+	leaseOwner string
+}
+
+type Option func(*ReadModel)
+
+// WithClock sets the clock leases expire by.
+func WithClock(clock clock.Clock) Option {
+	return func(m *ReadModel) {
+		m.clock = clock
+	}
+}
+
+// WithLeaseTTL sets how long the lock of rebuilds
+// is held without being renewed.
+func WithLeaseTTL(ttl time.Duration) Option {
+	return func(m *ReadModel) {
+		m.leaseTTL = ttl
+	}
+}
+
+// NewReadModel expects db to hold the articles, articles_shadow,
+// checkpoints, dead_letters and leases tables. It takes ownership of db,
+// which is closed by Close.
+func NewReadModel(db *sql.DB, dialect Dialect, opts ...Option) *ReadModel {
+	m := &ReadModel{
+		db:       db,
+		dialect:  dialect,
+		table:    liveTable,
+		clock:    clock.System{},
+		leaseTTL: DefaultLeaseTTL,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+const articleSelect = `id, user_id, title, body, tags, version, created_at, updated_at, published_at, deleted_at, purged`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanArticle(row scanner) (entity.Article, error) {
+	var article entity.Article
+	var tags []byte
+	var createdAt, updatedAt, publishedAt, deletedAt sql.NullInt64
+
+	err := row.Scan(&article.Id, &article.UserId, &article.Title, &article.Body, &tags, &article.Version,
+		&createdAt, &updatedAt, &publishedAt, &deletedAt, &article.Purged)
+	if err != nil {
+		return entity.Article{}, err
+	}
+
+	if err := json.Unmarshal(tags, &article.Tags); err != nil {
+		return entity.Article{}, err
+	}
+
+	article.CreatedAt = fromNullTime(createdAt)
+	article.UpdatedAt = fromNullTime(updatedAt)
+	article.PublishedAt = fromNullTime(publishedAt)
+	article.DeletedAt = fromNullTime(deletedAt)
+	return article, nil
+}
+
+// begin begins a transaction holding the lock of the table of the model.
+func (m *ReadModel) begin(ctx context.Context) (*sql.Tx, error) {
+	return begin(ctx, m.db, m.dialect, m.table, m.generation)
+}
+
+// begin begins a transaction holding the lock of table. If generation
+// is set, it fails with query.ErrSwapped unless Swap left the model
+// of the table at that generation.
+func begin(ctx context.Context, db *sql.DB, dialect Dialect, table string, generation *int64) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if dialect.Lock != "" {
+		if _, err := tx.ExecContext(ctx, dialect.Lock, table); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if generation != nil {
+		current, err := readGeneration(ctx, tx, dialect, table)
+		if err == nil && current != *generation {
+			err = query.ErrSwapped
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	return tx, nil
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func readGeneration(ctx context.Context, db queryer, dialect Dialect, table string) (int64, error) {
+	var generation int64
+	err := db.QueryRowContext(ctx, `SELECT generation FROM checkpoints WHERE model = `+dialect.Placeholder(1), table).Scan(&generation)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return generation, err
+}
+
+// Fence returns copies of the model and of deadLetters, which must
+// belong to it, whose writes fail once Swap replaces the contents.
+// Only Apply, SaveCheckpoint and Checkpoint of the copy are meant to be used.
+func (m *ReadModel) Fence(ctx context.Context, deadLetters query.DeadLetters) (query.ReadModel, query.DeadLetters, error) {
+	d, ok := deadLetters.(*DeadLetters)
+	if !ok || d.model != m.table {
+		return nil, nil, fmt.Errorf("cannot fence %T with the model %q", deadLetters, m.table)
+	}
+
+	generation, err := readGeneration(ctx, m.db, m.dialect, m.table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	model := &ReadModel{db: m.db, dialect: m.dialect, table: m.table, generation: &generation, clock: m.clock, leaseTTL: m.leaseTTL}
+	letters := &DeadLetters{db: d.db, dialect: d.dialect, model: d.model, generation: &generation}
+	return model, letters, nil
+}
+
+func (m *ReadModel) Apply(ctx context.Context, event entity.Event, version, position int64) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id := event.AggregateId()
+
+	row := tx.QueryRowContext(ctx, `SELECT `+articleSelect+` FROM `+m.table+` WHERE id = `+m.dialect.Placeholder(1), id)
+	article, err := scanArticle(row)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if version <= article.Version {
+		if err := m.advance(ctx, tx, position); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if version != article.Version+1 {
+		return query.VersionGap(id, article.Version, version)
+	}
+
+	if err := article.Apply(event); err != nil {
+		return err
+	}
+
+	if article.Purged {
+		article = entity.Article{Id: id, Version: article.Version, Purged: true}
+	}
+
+	if err := m.put(ctx, tx, article); err != nil {
+		return err
+	}
+
+	if err := m.advance(ctx, tx, position); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *ReadModel) put(ctx context.Context, tx *sql.Tx, article entity.Article) error {
+	tags := article.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	encodedTags, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+
+	args := args{dialect: m.dialect}
+	values := []string{
+		args.add(article.Id), args.add(article.UserId), args.add(article.Title), args.add(article.Body),
+		args.add(string(encodedTags)), args.add(article.Version),
+		args.add(nullTime(article.CreatedAt)), args.add(nullTime(article.UpdatedAt)),
+		args.add(nullTime(article.PublishedAt)), args.add(nullTime(article.DeletedAt)),
+		args.add(article.Purged),
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO `+m.table+` (`+articleSelect+`) VALUES (`+strings.Join(values, ", ")+`)
+		ON CONFLICT (id) DO UPDATE SET
+			user_id = excluded.user_id,
+			title = excluded.title,
+			body = excluded.body,
+			tags = excluded.tags,
+			version = excluded.version,
+			created_at = excluded.created_at,
+			updated_at = excluded.updated_at,
+			published_at = excluded.published_at,
+			deleted_at = excluded.deleted_at,
+			purged = excluded.purged`,
+		args.values...,
+	)
+	return err
+}
+
+// advance never moves the checkpoint backwards.
+func (m *ReadModel) advance(ctx context.Context, tx *sql.Tx, position int64) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO checkpoints (model, position) VALUES (%s, %s)
+		ON CONFLICT (model) DO UPDATE SET position = %s(checkpoints.position, excluded.position)`,
+		m.dialect.Placeholder(1), m.dialect.Placeholder(2), m.dialect.Greatest),
+		m.table, position,
+	)
+	return err
+}
+
+func (m *ReadModel) SaveCheckpoint(ctx context.Context, position int64) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.advance(ctx, tx, position); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *ReadModel) Checkpoint(ctx context.Context) (int64, error) {
+	var position int64
+	err := m.db.QueryRowContext(ctx, `SELECT position FROM checkpoints WHERE model = `+m.dialect.Placeholder(1), m.table).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return position, err
+}
+
+func (m *ReadModel) Tombstones(ctx context.Context, deletedBefore time.Time) ([]string, error) {
+	rows, err := m.db.QueryContext(ctx,
+		`SELECT id FROM `+m.table+` WHERE deleted_at IS NOT NULL AND deleted_at < `+m.dialect.Placeholder(1)+` AND NOT purged`,
+		deletedBefore.UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// visible matches articles which can be read by clients.
+const visible = `deleted_at IS NULL AND NOT purged`
+
+func (m *ReadModel) Get(ctx context.Context, id string) (entity.Article, error) {
+	row := m.db.QueryRowContext(ctx, `SELECT `+articleSelect+` FROM `+m.table+` WHERE id = `+m.dialect.Placeholder(1)+` AND `+visible, id)
+	article, err := scanArticle(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Article{}, entity.NotFound(id)
+	}
+	return article, err
+}
+
+func (m *ReadModel) List(ctx context.Context, params query.ListParams) (query.Page[entity.Article], error) {
+	sortColumn, direction, comparison := "created_at", "DESC", "<"
+	switch params.Order {
+	case query.OrderOldest:
+		direction, comparison = "ASC", ">"
+	case query.OrderRecentlyUpdated:
+		sortColumn = "updated_at"
+	}
+
+	where := []string{visible}
+	args := args{dialect: m.dialect}
+
+	filter := params.Filter
+	if filter.UserId != "" {
+		where = append(where, "user_id = "+args.add(filter.UserId))
+	}
+	if filter.Tag != "" {
+		where = append(where, m.dialect.HasTag(args.add(filter.Tag)))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= "+args.add(filter.CreatedAfter.UnixNano()))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		where = append(where, "created_at < "+args.add(filter.CreatedBefore.UnixNano()))
+	}
+
+	// Ties on the sort key are broken by ID in ascending order.
+	if after := params.After; after != nil {
+		key := after.SortKey.UnixNano()
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s %[3]s OR (%[1]s = %[4]s AND id > %[5]s))",
+			sortColumn, comparison, args.add(key), args.add(key), args.add(after.Id)))
+	}
+
+	stmt := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY %s %s, id ASC LIMIT %s`,
+		articleSelect, m.table, strings.Join(where, " AND "), sortColumn, direction, args.add(params.Limit+1))
+
+	rows, err := m.db.QueryContext(ctx, stmt, args.values...)
+	if err != nil {
+		return query.Page[entity.Article]{}, err
+	}
+	defer rows.Close()
+
+	page := query.Page[entity.Article]{}
+	for rows.Next() {
+		article, err := scanArticle(rows)
+		if err != nil {
+			return query.Page[entity.Article]{}, err
+		}
+		page.Items = append(page.Items, article)
+	}
+	if err := rows.Err(); err != nil {
+		return query.Page[entity.Article]{}, err
+	}
+
+	if len(page.Items) > params.Limit {
+		page.Items = page.Items[:params.Limit]
+		last := page.Items[len(page.Items)-1]
+
+		sortKey := last.CreatedAt
+		if params.Order == query.OrderRecentlyUpdated {
+			sortKey = last.UpdatedAt
+		}
+		page.Next = &query.Cursor{SortKey: sortKey, Id: last.Id}
+	}
+
+	return page, nil
+}
+
+func (m *ReadModel) Close() error {
+	return m.db.Close()
+}
+
+// Shadow empties the shadow table, so that a rebuild
+// interrupted before Swap starts over.
+func (m *ReadModel) Shadow(ctx context.Context) (query.ReadModel, error) {
+	shadow := &ReadModel{db: m.db, dialect: m.dialect, table: shadowTable}
+
+	tx, err := shadow.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := m.fence(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+shadow.table); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM checkpoints WHERE model = `+m.dialect.Placeholder(1), shadow.table); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM dead_letters WHERE model = `+m.dialect.Placeholder(1), shadow.table); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return shadow, nil
+}
+
+// Swap copies the shadow and its dead letters over the live ones in
+// a single transaction, which readers see either before or after it
+// commits. It moves the model to the next generation, so that other
+// replicas stop writing to it until they fence it again, see Fence.
+func (m *ReadModel) Swap(ctx context.Context, shadow query.ReadModel) error {
+	s, ok := shadow.(*ReadModel)
+	if !ok || s.table != shadowTable {
+		return fmt.Errorf("cannot swap in %T", shadow)
+	}
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.fence(ctx, tx); err != nil {
+		return err
+	}
+
+	var position int64
+	err = tx.QueryRowContext(ctx, `SELECT position FROM checkpoints WHERE model = `+m.dialect.Placeholder(1), s.table).Scan(&position)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	p := m.dialect.Placeholder
+	stmts := []struct {
+		stmt string
+		args []any
+	}{
+		{`DELETE FROM ` + m.table, nil},
+		{`INSERT INTO ` + m.table + ` SELECT * FROM ` + s.table, nil},
+		{`INSERT INTO checkpoints (model, position, generation) VALUES (` + p(1) + `, ` + p(2) + `, 1)
+			ON CONFLICT (model) DO UPDATE SET
+				position = excluded.position,
+				generation = checkpoints.generation + 1`, []any{m.table, position}},
+		{`DELETE FROM ` + s.table, nil},
+		{`DELETE FROM checkpoints WHERE model = ` + p(1), []any{s.table}},
+		{`DELETE FROM dead_letters WHERE model = ` + p(1), []any{m.table}},
+		{`UPDATE dead_letters SET model = ` + p(1) + ` WHERE model = ` + p(2), []any{m.table, s.table}},
+	}
+	for _, st := range stmts {
+		if _, err := tx.ExecContext(ctx, st.stmt, st.args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
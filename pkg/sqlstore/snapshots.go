@@ -0,0 +1,54 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+)
+
+// Snapshots is a cmd.SnapshotStore kept in the database of the event store.
+type Snapshots struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewSnapshots expects db to hold the snapshots table.
+// It does not take ownership of db.
+func NewSnapshots(db *sql.DB, dialect Dialect) *Snapshots {
+	return &Snapshots{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+func (s *Snapshots) Save(ctx context.Context, snapshot cmd.Snapshot) error {
+	p := s.dialect.Placeholder
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO snapshots (aggregate_id, version, schema_version, data) VALUES (%s, %s, %s, %s)
+		ON CONFLICT (aggregate_id) DO UPDATE SET
+			version = excluded.version,
+			schema_version = excluded.schema_version,
+			data = excluded.data
+		WHERE excluded.version >= snapshots.version`, p(1), p(2), p(3), p(4)),
+		snapshot.AggregateId, snapshot.Version, snapshot.SchemaVersion, snapshot.Data,
+	)
+	return err
+}
+
+func (s *Snapshots) Latest(ctx context.Context, aggregateId string) (cmd.Snapshot, bool, error) {
+	snapshot := cmd.Snapshot{AggregateId: aggregateId}
+
+	row := s.db.QueryRowContext(ctx, `SELECT version, schema_version, data FROM snapshots WHERE aggregate_id = `+s.dialect.Placeholder(1), aggregateId)
+	err := row.Scan(&snapshot.Version, &snapshot.SchemaVersion, &snapshot.Data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return cmd.Snapshot{}, false, nil
+	}
+	if err != nil {
+		return cmd.Snapshot{}, false, err
+	}
+
+	return snapshot, true, nil
+}
@@ -0,0 +1,54 @@
+// Package sqlstore implements the read model and the snapshots
+// on SQL databases. What differs between database engines
+// is described by a Dialect, the schema is created by
+// the migrations of the package of each engine.
+package sqlstore
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Dialect holds what differs between database engines.
+type Dialect struct {
+	// Placeholder returns the n-th parameter of a statement, starting at 1.
+	Placeholder func(n int) string
+	// Lock is executed first in every transaction writing to a table
+	// of the read model, with the name of the table as its only argument.
+	// It must block until no other transaction holds the lock of that table.
+	// It is left empty when beginning a transaction already locks
+	// the whole database.
+	Lock string
+	// Greatest names the function returning the greatest of its arguments.
+	Greatest string
+	// HasTag returns a condition matching articles whose JSON array
+	// of tags contains the parameter at placeholder.
+	HasTag func(placeholder string) string
+}
+
+// args collects parameters of a statement.
+type args struct {
+	dialect Dialect
+	values  []any
+}
+
+// add appends a parameter and returns its placeholder.
+func (a *args) add(v any) string {
+	a.values = append(a.values, v)
+	return a.dialect.Placeholder(len(a.values))
+}
+
+// nullTime stores zero times as NULL and others as Unix nanoseconds.
+func nullTime(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
+
+func fromNullTime(n sql.NullInt64) time.Time {
+	if !n.Valid {
+		return time.Time{}
+	}
+	return time.Unix(0, n.Int64).UTC()
+}
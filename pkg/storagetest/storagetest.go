@@ -0,0 +1,541 @@
+// Package storagetest is the contract every storage backend is tested
+// against, so that the service behaves the same whichever one it runs on.
+//
+// Every test opens a new, empty store, which is closed by the suite.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/cmd"
+	"github.com/krixlion/dev-forum_article/pkg/query"
+)
+
+// EventStore is implemented by every store events are published from.
+type EventStore interface {
+	cmd.EventStore
+	cmd.Outbox
+}
+
+// ReadModel is implemented by every read model the service can run on.
+type ReadModel interface {
+	query.Rebuildable
+	cmd.TombstoneFinder
+}
+
+// TestEventStore checks appends, reads and the outbox.
+func TestEventStore(t *testing.T, open func(t *testing.T) EventStore) {
+	ctx := context.Background()
+
+	t.Run("AppendAssignsVersionsAndPositions", func(t *testing.T) {
+		store := open(t)
+		defer store.Close()
+
+		appended, err := store.Append(ctx, "a", 0, []cmd.Event{{Id: "1", Type: "x", Data: []byte("one")}, {Id: "2", Type: "y"}})
+		if err != nil {
+			t.Fatalf("Failed to append, err: %v", err)
+		}
+		if len(appended) != 2 || appended[1].Version != 2 || appended[1].Position != 2 || appended[1].AggregateId != "a" {
+			t.Fatalf("Unexpected appended events: %+v", appended)
+		}
+		if _, err := store.Append(ctx, "b", 0, []cmd.Event{{Id: "3", Type: "z"}}); err != nil {
+			t.Fatalf("Failed to append, err: %v", err)
+		}
+
+		events, err := store.Load(ctx, "a", 1)
+		if err != nil {
+			t.Fatalf("Failed to load, err: %v", err)
+		}
+		if len(events) != 2 || events[0].Id != "1" || events[0].Type != "x" || !bytes.Equal(events[0].Data, []byte("one")) {
+			t.Fatalf("Unexpected events: %+v", events)
+		}
+		if events[0].RecordedAt.IsZero() {
+			t.Fatalf("Recording time was not set: %+v", events[0])
+		}
+
+		events, err = store.Load(ctx, "a", 2)
+		if err != nil {
+			t.Fatalf("Failed to load, err: %v", err)
+		}
+		if len(events) != 1 || events[0].Id != "2" || events[0].Version != 2 {
+			t.Fatalf("Unexpected events: %+v", events)
+		}
+
+		if events, err := store.Load(ctx, "unknown", 1); err != nil || len(events) != 0 {
+			t.Fatalf("Unknown stream is not empty, events: %+v, err: %v", events, err)
+		}
+	})
+
+	t.Run("AppendRejectsStaleVersion", func(t *testing.T) {
+		store := open(t)
+		defer store.Close()
+
+		if _, err := store.Append(ctx, "a", 0, []cmd.Event{{Id: "1", Type: "x"}, {Id: "2", Type: "y"}}); err != nil {
+			t.Fatalf("Failed to append, err: %v", err)
+		}
+
+		for _, expected := range []int64{0, 1, 3} {
+			_, err := store.Append(ctx, "a", expected, []cmd.Event{{Id: "stale", Type: "x"}})
+			if !errors.Is(err, entity.ErrConflict) {
+				t.Fatalf("Append at version %d was not rejected, err: %v", expected, err)
+			}
+		}
+
+		if head, err := store.Head(ctx); err != nil || head != 2 {
+			t.Fatalf("Rejected events were appended, head: %v, err: %v", head, err)
+		}
+	})
+
+	t.Run("ReadAllOrdersByPosition", func(t *testing.T) {
+		store := open(t)
+		defer store.Close()
+
+		if head, err := store.Head(ctx); err != nil || head != 0 {
+			t.Fatalf("Empty store has a head, head: %v, err: %v", head, err)
+		}
+
+		for i, id := range []string{"a", "b", "a", "c"} {
+			version := int64(0)
+			if i == 2 {
+				version = 1
+			}
+			if _, err := store.Append(ctx, id, version, []cmd.Event{{Id: fmt.Sprint(i + 1), Type: "x"}}); err != nil {
+				t.Fatalf("Failed to append, err: %v", err)
+			}
+		}
+
+		events, err := store.ReadAll(ctx, 1, 2)
+		if err != nil {
+			t.Fatalf("Failed to read, err: %v", err)
+		}
+		if len(events) != 2 || events[0].Position != 2 || events[1].Position != 3 || events[1].AggregateId != "a" || events[1].Version != 2 {
+			t.Fatalf("Unexpected events: %+v", events)
+		}
+
+		if events, err := store.ReadAll(ctx, 4, 10); err != nil || len(events) != 0 {
+			t.Fatalf("Events after the head were read, events: %+v, err: %v", events, err)
+		}
+		if head, err := store.Head(ctx); err != nil || head != 4 {
+			t.Fatalf("Unexpected head: %v, err: %v", head, err)
+		}
+	})
+
+	t.Run("OutboxKeepsUnsentEvents", func(t *testing.T) {
+		store := open(t)
+		defer store.Close()
+
+		if _, err := store.Append(ctx, "a", 0, []cmd.Event{{Id: "1", Type: "x"}, {Id: "2", Type: "y"}, {Id: "3", Type: "z"}}); err != nil {
+			t.Fatalf("Failed to append, err: %v", err)
+		}
+
+		if err := store.MarkSent(ctx, 2); err != nil {
+			t.Fatalf("Failed to mark events as sent, err: %v", err)
+		}
+		// The sent position never moves backwards.
+		if err := store.MarkSent(ctx, 1); err != nil {
+			t.Fatalf("Failed to mark events as sent, err: %v", err)
+		}
+		if err := store.MarkSent(ctx, 4); err == nil {
+			t.Fatalf("Position after the head was marked as sent")
+		}
+
+		unsent, err := store.Unsent(ctx, 10)
+		if err != nil {
+			t.Fatalf("Failed to read the outbox, err: %v", err)
+		}
+		if len(unsent) != 1 || unsent[0].Id != "3" {
+			t.Fatalf("Unexpected unsent events: %+v", unsent)
+		}
+	})
+
+	t.Run("AppendAndScrubIsAtomic", func(t *testing.T) {
+		store := open(t)
+		defer store.Close()
+
+		if _, err := store.Append(ctx, "a", 0, []cmd.Event{{Id: "1", Type: "x", Data: []byte("secret")}, {Id: "2", Type: "y", Data: []byte("kept")}}); err != nil {
+			t.Fatalf("Failed to append, err: %v", err)
+		}
+		if _, err := store.Append(ctx, "b", 0, []cmd.Event{{Id: "3", Type: "x", Data: []byte("other")}}); err != nil {
+			t.Fatalf("Failed to append, err: %v", err)
+		}
+		if _, err := store.Append(ctx, "a", 2, []cmd.Event{{Id: "4", Type: "z", Data: []byte("secret too")}}); err != nil {
+			t.Fatalf("Failed to append, err: %v", err)
+		}
+
+		// Neither the stale append nor the scrub happens.
+		_, err := store.AppendAndScrub(ctx, "a", 2, []cmd.Event{{Id: "stale", Type: "x"}}, map[int64][]byte{1: nil})
+		if !errors.Is(err, entity.ErrConflict) {
+			t.Fatalf("Append at a stale version was not rejected, err: %v", err)
+		}
+		if _, err := store.AppendAndScrub(ctx, "a", 3, []cmd.Event{{Id: "5", Type: "w"}}, map[int64][]byte{4: nil}); err == nil {
+			t.Fatalf("Event after the head of the stream was scrubbed")
+		}
+		if events, err := store.Load(ctx, "a", 1); err != nil || len(events) != 3 || string(events[0].Data) != "secret" {
+			t.Fatalf("Rejected scrub changed events: %+v, err: %v", events, err)
+		}
+
+		appended, err := store.AppendAndScrub(ctx, "a", 3, []cmd.Event{{Id: "5", Type: "w"}}, map[int64][]byte{1: []byte("-"), 3: nil})
+		if err != nil {
+			t.Fatalf("Failed to append and scrub, err: %v", err)
+		}
+		if len(appended) != 1 || appended[0].Version != 4 || appended[0].Position != 5 {
+			t.Fatalf("Unexpected appended events: %+v", appended)
+		}
+
+		events, err := store.Load(ctx, "a", 1)
+		if err != nil {
+			t.Fatalf("Failed to load, err: %v", err)
+		}
+		if len(events) != 4 || string(events[0].Data) != "-" || string(events[1].Data) != "kept" || len(events[2].Data) != 0 {
+			t.Fatalf("Unexpected events: %+v", events)
+		}
+		if events[2].Id != "4" || events[2].Type != "z" || events[2].Position != 4 {
+			t.Fatalf("Scrubbed event was changed: %+v", events[2])
+		}
+
+		all, err := store.ReadAll(ctx, 0, 10)
+		if err != nil {
+			t.Fatalf("Failed to read, err: %v", err)
+		}
+		if len(all) != 5 || string(all[0].Data) != "-" || string(all[2].Data) != "other" || len(all[3].Data) != 0 || all[4].Id != "5" {
+			t.Fatalf("Unexpected events: %+v", all)
+		}
+	})
+}
+
+// TestSnapshotStore checks that the latest snapshot is kept.
+func TestSnapshotStore(t *testing.T, open func(t *testing.T) cmd.SnapshotStore) {
+	ctx := context.Background()
+	store := open(t)
+
+	if _, ok, err := store.Latest(ctx, "a"); err != nil || ok {
+		t.Fatalf("Unknown snapshot was found, ok: %v, err: %v", ok, err)
+	}
+
+	snapshot := cmd.Snapshot{AggregateId: "a", Version: 5, SchemaVersion: 1, Data: []byte("five")}
+	if err := store.Save(ctx, snapshot); err != nil {
+		t.Fatalf("Failed to save snapshot, err: %v", err)
+	}
+	// Older snapshots saved late must not replace newer ones.
+	if err := store.Save(ctx, cmd.Snapshot{AggregateId: "a", Version: 3, SchemaVersion: 1, Data: []byte("three")}); err != nil {
+		t.Fatalf("Failed to save snapshot, err: %v", err)
+	}
+
+	got, ok, err := store.Latest(ctx, "a")
+	if err != nil || !ok {
+		t.Fatalf("Snapshot was not found, ok: %v, err: %v", ok, err)
+	}
+	if got.AggregateId != "a" || got.Version != 5 || got.SchemaVersion != 1 || !bytes.Equal(got.Data, snapshot.Data) {
+		t.Fatalf("Unexpected snapshot, got: %+v, want: %+v", got, snapshot)
+	}
+}
+
+// TestDeadLetters checks that letters are kept in the order of their events
+// and that they halt the later events of their aggregates.
+func TestDeadLetters(t *testing.T, open func(t *testing.T) query.DeadLetters) {
+	ctx := context.Background()
+	failedAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := open(t)
+
+	letter := func(aggregateId string, version, position int64, attempts int) query.DeadLetter {
+		return query.DeadLetter{
+			Event: cmd.Event{
+				Id:          fmt.Sprint(position),
+				AggregateId: aggregateId,
+				Version:     version,
+				Position:    position,
+				Type:        "x",
+				Data:        []byte("data"),
+				RecordedAt:  failedAt.Add(-time.Hour),
+			},
+			Err:      "failed",
+			Attempts: attempts,
+			FailedAt: failedAt,
+		}
+	}
+
+	for _, l := range []query.DeadLetter{letter("a", 3, 7, 0), letter("a", 2, 5, 3), letter("b", 1, 6, 3)} {
+		if err := store.Add(ctx, l); err != nil {
+			t.Fatalf("Failed to add dead letter, err: %v", err)
+		}
+	}
+
+	// A letter added again replaces the previous one.
+	retried := letter("a", 2, 5, 4)
+	retried.Err = "failed again"
+	if err := store.Add(ctx, retried); err != nil {
+		t.Fatalf("Failed to add dead letter, err: %v", err)
+	}
+
+	letters, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list dead letters, err: %v", err)
+	}
+	if len(letters) != 3 || letters[0].Event.Position != 5 || letters[1].Event.Position != 6 || letters[2].Event.Position != 7 {
+		t.Fatalf("Unexpected dead letters: %+v", letters)
+	}
+	got := letters[0]
+	if got.Err != "failed again" || got.Attempts != 4 || !got.FailedAt.Equal(failedAt) ||
+		got.Event.Id != "5" || got.Event.Version != 2 || !bytes.Equal(got.Event.Data, []byte("data")) || !got.Event.RecordedAt.Equal(retried.Event.RecordedAt) {
+		t.Fatalf("Unexpected dead letter, got: %+v, want: %+v", got, retried)
+	}
+
+	halted := func(aggregateId string, position int64) bool {
+		t.Helper()
+		halted, err := store.Halted(ctx, aggregateId, position)
+		if err != nil {
+			t.Fatalf("Failed to check aggregate, err: %v", err)
+		}
+		return halted
+	}
+
+	if halted("a", 5) || !halted("a", 6) || halted("c", 10) {
+		t.Fatal("Aggregates were not halted after their dead letters only")
+	}
+
+	if err := store.Remove(ctx, 5); err != nil {
+		t.Fatalf("Failed to remove dead letter, err: %v", err)
+	}
+	if err := store.Remove(ctx, 7); err != nil {
+		t.Fatalf("Failed to remove dead letter, err: %v", err)
+	}
+	if halted("a", 10) {
+		t.Fatal("Aggregate is halted without dead letters")
+	}
+
+	letters, err = store.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list dead letters, err: %v", err)
+	}
+	if len(letters) != 1 || letters[0].Event.AggregateId != "b" {
+		t.Fatalf("Unexpected dead letters: %+v", letters)
+	}
+}
+
+// TestReadModel checks projecting, listing and rebuilding articles.
+func TestReadModel(t *testing.T, open func(t *testing.T) ReadModel) {
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	created := func(id, userId string, at time.Time, tags ...string) entity.ArticleCreated {
+		return entity.ArticleCreated{ArticleId: id, UserId: userId, Title: "title " + id, Body: "body", Tags: tags, At: at}
+	}
+
+	t.Run("ApplyIgnoresRedeliveredEvents", func(t *testing.T) {
+		model := open(t)
+		defer model.Close()
+
+		if err := model.Apply(ctx, created("a", "user", now, "go"), 1, 1); err != nil {
+			t.Fatalf("Failed to apply, err: %v", err)
+		}
+		if err := model.Apply(ctx, created("a", "user", now), 1, 1); err != nil {
+			t.Fatalf("Failed to apply a redelivered event, err: %v", err)
+		}
+		if err := model.Apply(ctx, entity.ArticlePublished{ArticleId: "a", At: now}, 3, 2); err == nil {
+			t.Fatalf("Event after a gap was applied")
+		}
+
+		renamed := entity.ArticleTitleChanged{ArticleId: "a", Title: "renamed", At: now.Add(time.Minute)}
+		if err := model.Apply(ctx, renamed, 2, 3); err != nil {
+			t.Fatalf("Failed to apply, err: %v", err)
+		}
+
+		article, err := model.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Failed to get article, err: %v", err)
+		}
+		if article.Title != "renamed" || article.Version != 2 || len(article.Tags) != 1 || article.Tags[0] != "go" ||
+			!article.CreatedAt.Equal(now) || !article.UpdatedAt.Equal(renamed.At) {
+			t.Fatalf("Unexpected article: %+v", article)
+		}
+
+		if checkpoint, err := model.Checkpoint(ctx); err != nil || checkpoint != 3 {
+			t.Fatalf("Unexpected checkpoint: %v, err: %v", checkpoint, err)
+		}
+		// Skipped events move the checkpoint, which never moves backwards.
+		if err := model.SaveCheckpoint(ctx, 5); err != nil {
+			t.Fatalf("Failed to save checkpoint, err: %v", err)
+		}
+		if err := model.SaveCheckpoint(ctx, 4); err != nil {
+			t.Fatalf("Failed to save checkpoint, err: %v", err)
+		}
+		if checkpoint, err := model.Checkpoint(ctx); err != nil || checkpoint != 5 {
+			t.Fatalf("Unexpected checkpoint: %v, err: %v", checkpoint, err)
+		}
+	})
+
+	t.Run("DeletedArticlesAreHidden", func(t *testing.T) {
+		model := open(t)
+		defer model.Close()
+
+		events := []entity.Event{
+			created("a", "user", now),
+			entity.ArticleDeleted{ArticleId: "a", At: now.Add(time.Hour)},
+			created("b", "user", now),
+			entity.ArticleDeleted{ArticleId: "b", At: now.Add(time.Hour)},
+			entity.ArticlePurged{ArticleId: "b", At: now.Add(2 * time.Hour)},
+		}
+		versions := []int64{1, 2, 1, 2, 3}
+		for i, event := range events {
+			if err := model.Apply(ctx, event, versions[i], int64(i+1)); err != nil {
+				t.Fatalf("Failed to apply, err: %v", err)
+			}
+		}
+
+		for _, id := range []string{"a", "b"} {
+			if _, err := model.Get(ctx, id); !errors.Is(err, entity.ErrNotFound) {
+				t.Fatalf("Deleted article %q was found, err: %v", id, err)
+			}
+		}
+
+		page, err := model.List(ctx, query.ListParams{Limit: 10})
+		if err != nil || len(page.Items) != 0 {
+			t.Fatalf("Deleted articles were listed, page: %+v, err: %v", page, err)
+		}
+
+		if ids, err := model.Tombstones(ctx, now.Add(time.Hour)); err != nil || len(ids) != 0 {
+			t.Fatalf("Tombstones are not expired yet, ids: %v, err: %v", ids, err)
+		}
+		ids, err := model.Tombstones(ctx, now.Add(3*time.Hour))
+		if err != nil {
+			t.Fatalf("Failed to find tombstones, err: %v", err)
+		}
+		if len(ids) != 1 || ids[0] != "a" {
+			t.Fatalf("Unexpected tombstones: %v", ids)
+		}
+
+		restored := entity.ArticleRestored{ArticleId: "a", At: now.Add(3 * time.Hour)}
+		if err := model.Apply(ctx, restored, 3, 6); err != nil {
+			t.Fatalf("Failed to apply, err: %v", err)
+		}
+		if _, err := model.Get(ctx, "a"); err != nil {
+			t.Fatalf("Restored article was not found, err: %v", err)
+		}
+	})
+
+	t.Run("ListFiltersAndPages", func(t *testing.T) {
+		model := open(t)
+		defer model.Close()
+
+		// b and c are created at the same time, ties are broken by ID.
+		events := []entity.ArticleCreated{
+			created("a", "alice", now, "go"),
+			created("b", "bob", now.Add(time.Minute), "go", "sql"),
+			created("c", "alice", now.Add(time.Minute), "sql"),
+			created("d", "alice", now.Add(time.Hour), "go"),
+		}
+		for i, event := range events {
+			if err := model.Apply(ctx, event, 1, int64(i+1)); err != nil {
+				t.Fatalf("Failed to apply, err: %v", err)
+			}
+		}
+
+		list := func(params query.ListParams) []string {
+			t.Helper()
+
+			var ids []string
+			for {
+				page, err := model.List(ctx, params)
+				if err != nil {
+					t.Fatalf("Failed to list, err: %v", err)
+				}
+				if len(page.Items) > params.Limit {
+					t.Fatalf("Page is over the limit: %+v", page)
+				}
+				for _, article := range page.Items {
+					ids = append(ids, article.Id)
+				}
+				if page.Next == nil {
+					return ids
+				}
+				params.After = page.Next
+			}
+		}
+
+		tests := []struct {
+			params query.ListParams
+			want   string
+		}{
+			{query.ListParams{Limit: 10}, "[d b c a]"},
+			{query.ListParams{Limit: 1}, "[d b c a]"},
+			{query.ListParams{Order: query.OrderOldest, Limit: 2}, "[a b c d]"},
+			{query.ListParams{Filter: query.Filter{Tag: "go"}, Limit: 1}, "[d b a]"},
+			{query.ListParams{Filter: query.Filter{UserId: "alice", Tag: "sql"}, Limit: 1}, "[c]"},
+			{query.ListParams{Filter: query.Filter{CreatedAfter: now.Add(time.Minute), CreatedBefore: now.Add(time.Hour)}, Limit: 1}, "[b c]"},
+		}
+		for _, tt := range tests {
+			if got := fmt.Sprint(list(tt.params)); got != tt.want {
+				t.Errorf("Unexpected articles listed with %+v, got: %v, want: %v", tt.params, got, tt.want)
+			}
+		}
+
+		edited := entity.ArticleBodyEdited{ArticleId: "a", Body: "edited", At: now.Add(2 * time.Hour)}
+		if err := model.Apply(ctx, edited, 2, 5); err != nil {
+			t.Fatalf("Failed to apply, err: %v", err)
+		}
+		if got := fmt.Sprint(list(query.ListParams{Order: query.OrderRecentlyUpdated, Limit: 3})); got != "[a d b c]" {
+			t.Errorf("Unexpected recently updated articles, got: %v", got)
+		}
+	})
+
+	t.Run("RebuildIntoShadow", func(t *testing.T) {
+		model := open(t)
+		defer model.Close()
+
+		ctx := ctx
+		if locker, ok := model.(query.RebuildLocker); ok {
+			locked, unlock, err := locker.LockRebuild(ctx)
+			if err != nil {
+				t.Fatalf("Failed to lock rebuilds, err: %v", err)
+			}
+			defer unlock()
+			ctx = locked
+		}
+
+		if err := model.Apply(ctx, created("a", "user", now), 1, 1); err != nil {
+			t.Fatalf("Failed to apply, err: %v", err)
+		}
+
+		shadow, err := model.Shadow(ctx)
+		if err != nil {
+			t.Fatalf("Failed to create shadow, err: %v", err)
+		}
+		if checkpoint, err := shadow.Checkpoint(ctx); err != nil || checkpoint != 0 {
+			t.Fatalf("Shadow does not start empty, checkpoint: %v, err: %v", checkpoint, err)
+		}
+
+		rebuilt := created("a", "user", now)
+		rebuilt.Title = "rebuilt"
+		if err := shadow.Apply(ctx, rebuilt, 1, 1); err != nil {
+			t.Fatalf("Failed to apply to shadow, err: %v", err)
+		}
+		if err := shadow.Apply(ctx, created("b", "user", now), 1, 2); err != nil {
+			t.Fatalf("Failed to apply to shadow, err: %v", err)
+		}
+
+		if article, err := model.Get(ctx, "a"); err != nil || article.Title != "title a" {
+			t.Fatalf("Shadow is visible before the swap, got: %+v, err: %v", article, err)
+		}
+
+		if err := model.Swap(ctx, shadow); err != nil {
+			t.Fatalf("Failed to swap, err: %v", err)
+		}
+
+		article, err := model.Get(ctx, "a")
+		if err != nil || article.Title != "rebuilt" {
+			t.Fatalf("Shadow was not swapped in, got: %+v, err: %v", article, err)
+		}
+		if _, err := model.Get(ctx, "b"); err != nil {
+			t.Fatalf("Shadow was not swapped in, err: %v", err)
+		}
+		if checkpoint, err := model.Checkpoint(ctx); err != nil || checkpoint != 2 {
+			t.Fatalf("Unexpected checkpoint: %v, err: %v", checkpoint, err)
+		}
+	})
+}
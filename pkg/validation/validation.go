@@ -0,0 +1,151 @@
+// Package validation normalizes article content submitted by clients
+// and checks it against configurable limits.
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Rules configures the limits enforced by a Validator.
+// Zero limits are not enforced.
+type Rules struct {
+	// MinTitleLength and MaxTitleLength are counted in characters.
+	MinTitleLength int
+	MaxTitleLength int
+	// MaxBodyBytes is counted after normalization.
+	MaxBodyBytes int
+	// TitleCharacters and BodyCharacters list the allowed characters.
+	// An empty list allows every character which is not a control character.
+	TitleCharacters []*unicode.RangeTable
+	BodyCharacters  []*unicode.RangeTable
+}
+
+// DefaultRules allows titles of up to 200 printable characters
+// and bodies of up to 1 MiB.
+func DefaultRules() Rules {
+	printable := []*unicode.RangeTable{unicode.L, unicode.M, unicode.N, unicode.P, unicode.S, unicode.Zs}
+
+	return Rules{
+		MinTitleLength:  1,
+		MaxTitleLength:  200,
+		MaxBodyBytes:    1 << 20,
+		TitleCharacters: printable,
+		BodyCharacters:  append(printable, newlines),
+	}
+}
+
+// newlines allows line breaks and tabs in bodies.
+var newlines = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: '\t', Hi: '\n', Stride: 1},
+	},
+}
+
+type Validator struct {
+	rules Rules
+}
+
+func NewValidator(rules Rules) Validator {
+	return Validator{
+		rules: rules,
+	}
+}
+
+// Title returns the normalized title along with every rule it breaks.
+// Normalization applies NFC, removes control characters
+// and trims surrounding white space.
+func (v Validator) Title(title string) (string, []entity.FieldViolation) {
+	const field = "article.title"
+
+	title = strings.TrimSpace(normalize(title, false))
+
+	var violations []entity.FieldViolation
+	length := utf8.RuneCountInString(title)
+	if v.rules.MinTitleLength > 0 && length < v.rules.MinTitleLength {
+		violations = append(violations, entity.FieldViolation{
+			Field:       field,
+			Description: fmt.Sprintf("must be at least %d characters long", v.rules.MinTitleLength),
+		})
+	}
+	if v.rules.MaxTitleLength > 0 && length > v.rules.MaxTitleLength {
+		violations = append(violations, entity.FieldViolation{
+			Field:       field,
+			Description: fmt.Sprintf("must be at most %d characters long", v.rules.MaxTitleLength),
+		})
+	}
+	if r, ok := disallowed(title, v.rules.TitleCharacters); ok {
+		violations = append(violations, entity.FieldViolation{
+			Field:       field,
+			Description: fmt.Sprintf("contains a disallowed character %q", r),
+		})
+	}
+
+	return title, violations
+}
+
+// Body returns the normalized body along with every rule it breaks.
+// Normalization applies NFC, converts CRLF line breaks to LF, removes
+// control characters other than line breaks and tabs and trims
+// surrounding white space.
+func (v Validator) Body(body string) (string, []entity.FieldViolation) {
+	const field = "article.body"
+
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	body = strings.TrimSpace(normalize(body, true))
+
+	var violations []entity.FieldViolation
+	if v.rules.MaxBodyBytes > 0 && len(body) > v.rules.MaxBodyBytes {
+		violations = append(violations, entity.FieldViolation{
+			Field:       field,
+			Description: fmt.Sprintf("must be at most %d bytes long", v.rules.MaxBodyBytes),
+		})
+	}
+	if r, ok := disallowed(body, v.rules.BodyCharacters); ok {
+		violations = append(violations, entity.FieldViolation{
+			Field:       field,
+			Description: fmt.Sprintf("contains a disallowed character %q", r),
+		})
+	}
+
+	return body, violations
+}
+
+// normalize converts s to NFC and removes control characters,
+// keeping line breaks and tabs if multiline is set.
+// Invalid UTF-8 sequences are replaced with U+FFFD.
+func normalize(s string, multiline bool) string {
+	s = strings.ToValidUTF8(s, string(utf8.RuneError))
+
+	s = strings.Map(func(r rune) rune {
+		if multiline && (r == '\n' || r == '\t') {
+			return r
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+
+	return norm.NFC.String(s)
+}
+
+// disallowed returns the first character of s which is not in allowed.
+func disallowed(s string, allowed []*unicode.RangeTable) (rune, bool) {
+	if len(allowed) == 0 {
+		return 0, false
+	}
+
+	for _, r := range s {
+		if !unicode.IsOneOf(allowed, r) {
+			return r, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,219 @@
+package validation_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+
+	entity "github.com/krixlion/dev-forum_article/pkg/article"
+	"github.com/krixlion/dev-forum_article/pkg/validation"
+)
+
+func titleViolation(description string) []entity.FieldViolation {
+	return []entity.FieldViolation{{Field: "article.title", Description: description}}
+}
+
+func bodyViolation(description string) []entity.FieldViolation {
+	return []entity.FieldViolation{{Field: "article.body", Description: description}}
+}
+
+func TestTitle(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules validation.Rules
+		title string
+		want  string
+		// violations are nil for valid titles.
+		violations []entity.FieldViolation
+	}{
+		{
+			name:  "valid",
+			rules: validation.DefaultRules(),
+			title: "Go 1.21: what's new? \U0001f642",
+			want:  "Go 1.21: what's new? \U0001f642",
+		},
+		{
+			name:  "decomposed characters are composed",
+			rules: validation.DefaultRules(),
+			title: "Cafe\u0301",
+			want:  "Caf\u00e9",
+		},
+		{
+			name:  "control characters are removed",
+			rules: validation.DefaultRules(),
+			title: "Ti\x00tle\x1b[0m\t\n",
+			want:  "Title[0m",
+		},
+		{
+			name:  "surrounding white space is trimmed",
+			rules: validation.DefaultRules(),
+			title: "   title\u3000 ",
+			want:  "title",
+		},
+		{
+			name:  "invalid UTF-8 is replaced",
+			rules: validation.DefaultRules(),
+			title: "title\xff",
+			want:  "title\ufffd",
+		},
+		{
+			name:       "empty after normalization",
+			rules:      validation.DefaultRules(),
+			title:      " \x01 ",
+			want:       "",
+			violations: titleViolation("must be at least 1 characters long"),
+		},
+		{
+			name:  "longest title",
+			rules: validation.DefaultRules(),
+			title: strings.Repeat("\u00e9", 200),
+			want:  strings.Repeat("\u00e9", 200),
+		},
+		{
+			name:       "too long",
+			rules:      validation.DefaultRules(),
+			title:      strings.Repeat("\u00e9", 201),
+			want:       strings.Repeat("\u00e9", 201),
+			violations: titleViolation("must be at most 200 characters long"),
+		},
+		{
+			name:  "length is counted after normalization",
+			rules: validation.DefaultRules(),
+			title: strings.Repeat("e\u0301", 200),
+			want:  strings.Repeat("\u00e9", 200),
+		},
+		{
+			name:       "too short",
+			rules:      validation.Rules{MinTitleLength: 3},
+			title:      "ab",
+			want:       "ab",
+			violations: titleViolation("must be at least 3 characters long"),
+		},
+		{
+			name:       "format characters are not allowed",
+			rules:      validation.DefaultRules(),
+			title:      "zero\u200bwidth",
+			want:       "zero\u200bwidth",
+			violations: titleViolation(`contains a disallowed character '\u200b'`),
+		},
+		{
+			name:       "outside of configured ranges",
+			rules:      validation.Rules{TitleCharacters: []*unicode.RangeTable{unicode.Latin, unicode.Zs}},
+			title:      "title 2",
+			want:       "title 2",
+			violations: titleViolation("contains a disallowed character '2'"),
+		},
+		{
+			name:  "no limits",
+			rules: validation.Rules{},
+			title: strings.Repeat("\u200b", 300),
+			want:  strings.Repeat("\u200b", 300),
+		},
+		{
+			name:  "every rule is reported",
+			rules: validation.Rules{MaxTitleLength: 2, TitleCharacters: []*unicode.RangeTable{unicode.Latin}},
+			title: "abc1",
+			want:  "abc1",
+			violations: append(
+				titleViolation("must be at most 2 characters long"),
+				titleViolation("contains a disallowed character '1'")...,
+			),
+		},
+	}
+
+	for _, test := range tests {
+		got, violations := validation.NewValidator(test.rules).Title(test.title)
+		if got != test.want {
+			t.Errorf("%s: unexpected title, got: %q, want: %q", test.name, got, test.want)
+		}
+		if !reflect.DeepEqual(violations, test.violations) {
+			t.Errorf("%s: unexpected violations, got: %+v, want: %+v", test.name, violations, test.violations)
+		}
+	}
+}
+
+func TestBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules validation.Rules
+		body  string
+		want  string
+		// violations are nil for valid bodies.
+		violations []entity.FieldViolation
+	}{
+		{
+			name:  "valid",
+			rules: validation.DefaultRules(),
+			body:  "# Title\n\n\tcode();\n",
+			want:  "# Title\n\n\tcode();",
+		},
+		{
+			name:  "line breaks are converted to LF",
+			rules: validation.DefaultRules(),
+			body:  "first\r\nsecond\r\n\r\nthird",
+			want:  "first\nsecond\n\nthird",
+		},
+		{
+			name:  "control characters other than line breaks and tabs are removed",
+			rules: validation.DefaultRules(),
+			body:  "a\x00b\rc\td\x7fe\u0085f\n",
+			want:  "abc\tdef",
+		},
+		{
+			name:  "decomposed characters are composed",
+			rules: validation.DefaultRules(),
+			body:  "A\u030angstro\u0308m",
+			want:  "\u00c5ngstr\u00f6m",
+		},
+		{
+			name:  "largest body",
+			rules: validation.Rules{MaxBodyBytes: 4},
+			body:  "\u00e9\u00e9",
+			want:  "\u00e9\u00e9",
+		},
+		{
+			name:       "too large",
+			rules:      validation.Rules{MaxBodyBytes: 4},
+			body:       "\u00e9\u00e9\u00e9",
+			want:       "\u00e9\u00e9\u00e9",
+			violations: bodyViolation("must be at most 4 bytes long"),
+		},
+		{
+			name:  "size is counted after normalization",
+			rules: validation.Rules{MaxBodyBytes: 4},
+			body:  "  e\u0301e\u0301\r\n",
+			want:  "\u00e9\u00e9",
+		},
+		{
+			name:       "format characters are not allowed",
+			rules:      validation.DefaultRules(),
+			body:       "right\u202eto left",
+			want:       "right\u202eto left",
+			violations: bodyViolation(`contains a disallowed character '\u202e'`),
+		},
+		{
+			name:       "outside of configured ranges",
+			rules:      validation.Rules{BodyCharacters: []*unicode.RangeTable{unicode.Latin}},
+			body:       "one\ntwo",
+			want:       "one\ntwo",
+			violations: bodyViolation(`contains a disallowed character '\n'`),
+		},
+		{
+			name:  "no limits",
+			rules: validation.Rules{},
+			body:  strings.Repeat("\u200b", 300),
+			want:  strings.Repeat("\u200b", 300),
+		},
+	}
+
+	for _, test := range tests {
+		got, violations := validation.NewValidator(test.rules).Body(test.body)
+		if got != test.want {
+			t.Errorf("%s: unexpected body, got: %q, want: %q", test.name, got, test.want)
+		}
+		if !reflect.DeepEqual(violations, test.violations) {
+			t.Errorf("%s: unexpected violations, got: %+v, want: %+v", test.name, violations, test.violations)
+		}
+	}
+}